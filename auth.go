@@ -0,0 +1,326 @@
+package gorpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 认证与授权
+// 服务端设置 Authenticator 后，每个请求在处理之前都会先认证，认证得到的主体放在调用的上下文中
+// 之后在调用方法之前按照 AuthRules 检查主体是否有权调用这个方法
+// 内置服务不需要认证和授权
+
+// Principal 认证得到的调用方身份
+type Principal struct {
+	Name   string // 主体名，授权规则按照这个名字匹配
+	Scheme string // 认证方式，如 bearer、hmac、mtls
+}
+
+// Authenticator 认证器
+// 请求中没有这种认证方式需要的凭证时返回 nil, nil，凭证无效时返回错误
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthRule 授权规则，Service 和 Method 都匹配时生效，按顺序使用第一条匹配的规则
+// 没有匹配的规则时，任何认证过的主体都可以调用
+type AuthRule struct {
+	Service string   // 服务名，"*" 匹配所有服务
+	Method  string   // 方法名，"*" 匹配所有方法
+	Allow   []string // 允许调用的主体名，"*" 表示任何认证过的主体
+	Public  bool     // 为 true 时不需要认证，任何人都可以调用
+}
+
+func (r *AuthRule) match(service, method string) bool {
+	return (r.Service == "*" || r.Service == service) && (r.Method == "*" || r.Method == method)
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext 获取调用方认证后的身份
+// 方法的第一个参数是 context.Context 时可以在方法中使用
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// authenticate 为请求创建调用的上下文，其中带有调用方的信息和认证得到的主体
+// 凭证无效时返回 CodeUnauthenticated，没有凭证不算错误，在授权时处理
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := peerContext(r)
+	// 在响应中带上请求 ID，方便调用方和服务端的日志对应
+	id, _ := RequestIDFromContext(ctx)
+	w.Header().Set(RequestIDHeader, id)
+	if s.Authenticator == nil {
+		return ctx, nil
+	}
+	// 认证器可能需要读取请求体
+	if s.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+	}
+	p, err := s.Authenticator.Authenticate(r)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, err
+		}
+		return nil, Errorf(CodeUnauthenticated, "rpc server: authentication failed: %v", err)
+	}
+	if p != nil {
+		ctx = context.WithValue(ctx, principalKey{}, p)
+	}
+	return ctx, nil
+}
+
+// authenticateMetadata 对 /introspect、/openapi.json 和 /metrics 的请求认证
+// 设置了认证器并且没有开启 PublicMetadata 时需要认证过的主体，失败时写入错误响应并返回 false
+func (s *Server) authenticateMetadata(w http.ResponseWriter, r *http.Request) bool {
+	if s.Authenticator == nil || s.PublicMetadata {
+		return true
+	}
+	ctx, err := s.authenticate(w, r)
+	if err != nil {
+		s.logger().Error("rpc server: authenticate failed", "path", r.URL.Path, "err", err)
+		s.sendAuthErr(w, err)
+		return false
+	}
+	if _, ok := PrincipalFromContext(ctx); !ok {
+		s.sendErr(w, Errorf(CodeUnauthenticated, "rpc server: %s requires authentication", r.URL.Path), HTTPStatus(CodeUnauthenticated))
+		return false
+	}
+	return true
+}
+
+// authorize 检查调用方是否有权调用方法
+// 没有设置认证器和授权规则时不做任何检查
+func (s *Server) authorize(ctx context.Context, service, method string) error {
+	if s.Authenticator == nil && len(s.AuthRules) == 0 {
+		return nil
+	}
+	var rule *AuthRule
+	for i := range s.AuthRules {
+		if s.AuthRules[i].match(service, method) {
+			rule = &s.AuthRules[i]
+			break
+		}
+	}
+	if rule != nil && rule.Public {
+		return nil
+	}
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return Errorf(CodeUnauthenticated, "rpc server: %s.%s requires authentication", service, method)
+	}
+	if rule == nil || slices.Contains(rule.Allow, "*") || slices.Contains(rule.Allow, p.Name) {
+		return nil
+	}
+	return Errorf(CodePermissionDenied, "rpc server: %s is not allowed to call %s.%s", p.Name, service, method)
+}
+
+// ChainAuthenticator 依次尝试多个认证器，使用第一个得到主体的结果
+// 任何一个认证器返回错误时认证失败
+func ChainAuthenticator(authenticators ...Authenticator) Authenticator {
+	return chainAuthenticator(authenticators)
+}
+
+type chainAuthenticator []Authenticator
+
+func (c chainAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if err != nil || p != nil {
+			return p, err
+		}
+	}
+	return nil, nil
+}
+
+// BearerAuthenticator 使用 Authorization: Bearer <token> 认证
+type BearerAuthenticator struct {
+	Tokens map[string]string // token -> 主体名
+}
+
+func (a *BearerAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, nil
+	}
+	for t, name := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return &Principal{Name: name, Scheme: "bearer"}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid bearer token")
+}
+
+// HMAC 签名使用的请求头
+const (
+	HeaderAuthKey       = "X-Auth-Key"
+	HeaderAuthTimestamp = "X-Auth-Timestamp"
+	HeaderAuthNonce     = "X-Auth-Nonce"
+	HeaderAuthSignature = "X-Auth-Signature"
+)
+
+// DefaultHMACMaxSkew 签名时间与服务端时间的默认最大差值
+const DefaultHMACMaxSkew = 5 * time.Minute
+
+// DefaultHMACMaxBodySize 认证时默认最多读取的请求体字节数
+const DefaultHMACMaxBodySize = 4 << 20
+
+// HMACAuthenticator 使用 HMAC-SHA256 签名认证
+// 签名覆盖时间戳、随机数、HTTP 方法、路径、X-Header 和请求体，客户端使用 HMACCredentials 签名
+// 时间戳只在 MaxSkew 内有效，这段时间内用过的随机数会被记住，重放的请求会被拒绝
+// 随机数只记录在这个认证器中，多个服务端实例之间不共享，请求被重放到其他实例时仍然有效
+// 验证签名需要把请求体读入内存，超过 MaxBodySize 的请求体返回 *http.MaxBytesError，服务端据此返回413
+type HMACAuthenticator struct {
+	Keys        map[string][]byte // 密钥 ID -> 密钥，密钥 ID 同时作为主体名
+	MaxSkew     time.Duration     // 为0时使用 DefaultHMACMaxSkew
+	MaxBodySize int64             // 为0时使用 DefaultHMACMaxBodySize
+
+	mutex     sync.Mutex
+	nonces    map[string]time.Time // 密钥 ID + 随机数 -> 过期时间
+	lastSweep time.Time
+}
+
+func (a *HMACAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	keyID := r.Header.Get(HeaderAuthKey)
+	if keyID == "" {
+		return nil, nil
+	}
+	secret, ok := a.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", keyID)
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderAuthTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp")
+	}
+	skew := a.MaxSkew
+	if skew <= 0 {
+		skew = DefaultHMACMaxSkew
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > skew || d < -skew {
+		return nil, fmt.Errorf("timestamp out of range")
+	}
+	nonce := r.Header.Get(HeaderAuthNonce)
+	if nonce == "" {
+		return nil, fmt.Errorf("missing nonce")
+	}
+	limit := a.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultHMACMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	expected := hmacSignature(secret, r.Header.Get(HeaderAuthTimestamp), nonce, r.Method, r.URL.Path, r.Header.Get("X-Header"), body)
+	signature, err := hex.DecodeString(r.Header.Get(HeaderAuthSignature))
+	if err != nil || !hmac.Equal(signature, expected) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	// 签名正确之后才记录随机数，避免没有密钥的请求填满缓存
+	if !a.useNonce(keyID+"\x00"+nonce, time.Unix(ts, 0).Add(skew), skew) {
+		return nil, fmt.Errorf("nonce already used")
+	}
+	return &Principal{Name: keyID, Scheme: "hmac"}, nil
+}
+
+// useNonce 记录一个随机数，在过期之前已经用过时返回 false
+// 时间戳超过 MaxSkew 的请求已经被拒绝，所以随机数只需要保留到 expire
+func (a *HMACAuthenticator) useNonce(key string, expire time.Time, skew time.Duration) bool {
+	now := time.Now()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.nonces == nil {
+		a.nonces = make(map[string]time.Time)
+		a.lastSweep = now
+	}
+	if now.Sub(a.lastSweep) >= skew {
+		a.lastSweep = now
+		for k, t := range a.nonces {
+			if now.After(t) {
+				delete(a.nonces, k)
+			}
+		}
+	}
+	if t, ok := a.nonces[key]; ok && !now.After(t) {
+		return false
+	}
+	a.nonces[key] = expire
+	return true
+}
+
+// hmacSignature 计算请求的签名
+func hmacSignature(secret []byte, timestamp, nonce, method, path, header string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + method + "\n" + path + "\n" + header + "\n" + hex.EncodeToString(digest[:])))
+	return mac.Sum(nil)
+}
+
+// MTLSAuthenticator 使用经过验证的客户端证书认证，主体名为 Peer.Identity
+// 服务端需要在 TLSConfig 中设置 ClientCAs
+type MTLSAuthenticator struct{}
+
+func (MTLSAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	peer := &Peer{Addr: r.RemoteAddr, TLS: r.TLS}
+	name := peer.Identity()
+	if name == "" {
+		return nil, nil
+	}
+	return &Principal{Name: name, Scheme: "mtls"}, nil
+}
+
+// Credentials 客户端的凭证，在请求发送之前添加到请求上
+// body 为实际发送的请求体
+type Credentials interface {
+	Apply(req *http.Request, body []byte) error
+}
+
+// BearerToken 使用 Authorization: Bearer <token> 的凭证
+type BearerToken string
+
+func (t BearerToken) Apply(req *http.Request, body []byte) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// HMACCredentials 使用 HMAC-SHA256 签名的凭证，与 HMACAuthenticator 对应
+type HMACCredentials struct {
+	KeyID  string
+	Secret []byte
+}
+
+func (c *HMACCredentials) Apply(req *http.Request, body []byte) error {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b[:])
+	signature := hmacSignature(c.Secret, ts, nonce, req.Method, req.URL.Path, req.Header.Get("X-Header"), body)
+	req.Header.Set(HeaderAuthKey, c.KeyID)
+	req.Header.Set(HeaderAuthTimestamp, ts)
+	req.Header.Set(HeaderAuthNonce, nonce)
+	req.Header.Set(HeaderAuthSignature, hex.EncodeToString(signature))
+	return nil
+}
@@ -0,0 +1,142 @@
+package gorpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wifi32767/HTTPGoRpc/metrics"
+)
+
+// withAuthenticator 在测试期间为共用的服务端设置认证器
+func withAuthenticator(t *testing.T, s *Server, a Authenticator) {
+	t.Helper()
+	old := s.Authenticator
+	s.Authenticator = a
+	t.Cleanup(func() {
+		s.Authenticator = old
+		s.PublicMetadata = false
+	})
+}
+
+func TestMetadataRequiresAuthentication(t *testing.T) {
+	s, addr := startTestServer(t)
+	withAuthenticator(t, s, &BearerAuthenticator{Tokens: map[string]string{"secret": "alice"}})
+	for _, path := range []string{"/introspect", OpenAPIPath, metrics.Path} {
+		get := func(token string) int {
+			req, err := http.NewRequest("GET", "http://"+addr+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		if code := get(""); code != http.StatusUnauthorized {
+			t.Errorf("%s without credentials: status %d, want 401", path, code)
+		}
+		if code := get("wrong"); code != http.StatusUnauthorized {
+			t.Errorf("%s with an invalid token: status %d, want 401", path, code)
+		}
+		if code := get("secret"); code != http.StatusOK {
+			t.Errorf("%s with a valid token: status %d, want 200", path, code)
+		}
+		s.PublicMetadata = true
+		if code := get(""); code != http.StatusOK {
+			t.Errorf("%s with PublicMetadata: status %d, want 200", path, code)
+		}
+		s.PublicMetadata = false
+	}
+}
+
+func TestHMACRejectsReplay(t *testing.T) {
+	secret := []byte("key")
+	a := &HMACAuthenticator{Keys: map[string][]byte{"svc": secret}}
+	creds := &HMACCredentials{KeyID: "svc", Secret: secret}
+	body := []byte(`{"a":1}`)
+	newReq := func() *http.Request {
+		return httptest.NewRequest("POST", "/call", bytes.NewReader(body))
+	}
+
+	req := newReq()
+	if err := creds.Apply(req, body); err != nil {
+		t.Fatal(err)
+	}
+	p, err := a.Authenticate(req)
+	if err != nil || p == nil || p.Name != "svc" {
+		t.Fatalf("first request: principal %v, err %v", p, err)
+	}
+
+	// 原样重放
+	replay := newReq()
+	replay.Header = req.Header.Clone()
+	if _, err := a.Authenticate(replay); err == nil {
+		t.Fatal("replayed request should be rejected")
+	}
+
+	// 没有随机数
+	noNonce := newReq()
+	noNonce.Header = req.Header.Clone()
+	noNonce.Header.Del(HeaderAuthNonce)
+	if _, err := a.Authenticate(noNonce); err == nil {
+		t.Fatal("request without a nonce should be rejected")
+	}
+
+	// 新的签名使用新的随机数
+	next := newReq()
+	if err := creds.Apply(next, body); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(next); err != nil {
+		t.Fatalf("second request: %v", err)
+	}
+}
+
+func TestHMACCall(t *testing.T) {
+	s, addr := startTestServer(t)
+	secret := []byte("key")
+	withAuthenticator(t, s, &HMACAuthenticator{Keys: map[string][]byte{"svc": secret}})
+	cli := NewClient(addr, &Options{Credentials: &HMACCredentials{KeyID: "svc", Secret: secret}})
+	for i := 0; i < 2; i++ {
+		var reply testReply
+		if err := cli.Call(context.Background(), testServiceName, "Add", &testArgs{A: 1, B: i}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewClient(addr).Call(context.Background(), testServiceName, "Add", &testArgs{}, &testReply{}); CodeOf(err) != CodeUnauthenticated {
+		t.Fatalf("call without credentials: %v", err)
+	}
+}
+
+func TestHMACMaxBodySize(t *testing.T) {
+	secret := []byte("key")
+	a := &HMACAuthenticator{Keys: map[string][]byte{"svc": secret}, MaxBodySize: 16}
+	creds := &HMACCredentials{KeyID: "svc", Secret: secret}
+	for _, tt := range []struct {
+		size    int
+		tooLong bool
+	}{{16, false}, {17, true}} {
+		body := bytes.Repeat([]byte("a"), tt.size)
+		req := httptest.NewRequest("POST", "/call", bytes.NewReader(body))
+		if err := creds.Apply(req, body); err != nil {
+			t.Fatal(err)
+		}
+		_, err := a.Authenticate(req)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) != tt.tooLong {
+			t.Fatalf("body of %d bytes: err %v", tt.size, err)
+		}
+		if !tt.tooLong && err != nil {
+			t.Fatalf("body of %d bytes: %v", tt.size, err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package gorpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+// 批量调用
+// 把多个调用合并为一个 HTTP 请求，减少大量小调用的开销
+// 请求和响应都是 JSON，每个调用的参数和返回值使用头部中的编解码器单独编码
+// 每个调用都单独经过授权、限流和并发限制，结果和错误也分别返回
+
+const BatchPath = "/batch"
+
+// DefaultBatchConcurrency 并发执行批量调用时默认的协程数
+const DefaultBatchConcurrency = 16
+
+type batchRequest struct {
+	Ordered bool        `json:"ordered"` // 为 true 时按顺序依次执行，否则并发执行
+	Calls   []batchCall `json:"calls"`
+}
+
+type batchCall struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+	Arg     []byte `json:"arg"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+type batchResult struct {
+	Reply      []byte        `json:"reply,omitempty"`
+	Code       Code          `json:"code"` // 为 CodeOK 表示调用成功，失败时一定不是 CodeOK
+	Error      string        `json:"error,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+}
+
+// batch 处理批量调用请求
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Type") != TypeBatch {
+		s.logger().Error("rpc server: wrong message type", "type", r.Header.Get("X-Type"), "peer", r.RemoteAddr)
+		s.sendErr(w, fmt.Errorf("rpc server: wrong message type"), http.StatusBadRequest)
+		return
+	}
+	ctx, err := s.authenticate(w, r)
+	if err != nil {
+		s.logger().Error("rpc server: authenticate failed", "err", err)
+		s.sendAuthErr(w, err)
+		return
+	}
+	header, err := s.parseHeader(r)
+	if err != nil {
+		s.logger().Error("rpc server: parse header failed", "err", err)
+		s.sendErr(w, err, http.StatusBadRequest)
+		return
+	}
+	if header.Option.MagicNumber != MagicNumber {
+		s.logger().Error("rpc server: invalid magic number", "magic_number", header.Option.MagicNumber)
+		s.sendErr(w, Errorf(CodeInvalidArgument, "rpc server: invalid magic number %d", header.Option.MagicNumber), http.StatusBadRequest)
+		return
+	}
+	cc := codec.NewCodec(header.Option.CodecType)
+	if cc == nil {
+		s.logger().Error("rpc server: unsupported codec type", "codec", header.Option.CodecType)
+		s.sendErr(w, fmt.Errorf("rpc server: unsupported codec type %s", header.Option.CodecType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if !s.decompressBody(w, r) {
+		return
+	}
+	defer r.Body.Close()
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.logger().Error("rpc server: decode batch request failed", "err", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.sendErr(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.sendErr(w, Errorf(CodeInvalidArgument, "rpc server: invalid batch request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Calls) == 0 {
+		s.sendErr(w, Errorf(CodeInvalidArgument, "rpc server: empty batch"), http.StatusBadRequest)
+		return
+	}
+	if s.MaxBatchSize > 0 && len(req.Calls) > s.MaxBatchSize {
+		s.sendErr(w, Errorf(CodeInvalidArgument, "rpc server: batch of %d calls exceeds the limit of %d", len(req.Calls), s.MaxBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	msg, err := json.Marshal(batchResponse{Results: s.runBatch(ctx, cc, &req)})
+	if err != nil {
+		s.logger().Error("rpc server: marshal batch response failed", "err", err)
+		s.sendErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	s.sendResp(w, msg, acceptedEncoding(r))
+}
+
+// runBatch 执行批量调用中的所有调用，结果的顺序与请求一致
+// 每个调用的请求 ID 为批量请求的请求 ID 加上序号
+func (s *Server) runBatch(ctx context.Context, cc codec.Codec, req *batchRequest) []batchResult {
+	results := make([]batchResult, len(req.Calls))
+	id, _ := RequestIDFromContext(ctx)
+	run := func(i int) {
+		results[i] = s.batchOne(WithRequestID(ctx, fmt.Sprintf("%s-%d", id, i)), cc, &req.Calls[i])
+	}
+	if req.Ordered {
+		for i := range req.Calls {
+			run(i)
+		}
+		return results
+	}
+	parallel(len(req.Calls), s.batchConcurrency(), run)
+	return results
+}
+
+// batchConcurrency 并发执行批量调用时的协程数
+func (s *Server) batchConcurrency() int {
+	if s.BatchConcurrency > 0 {
+		return s.BatchConcurrency
+	}
+	return DefaultBatchConcurrency
+}
+
+// parallel 用最多 workers 个协程执行 f(0) 到 f(n-1)，全部执行完之后返回
+func parallel(n, workers int, f func(i int)) {
+	workers = min(workers, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// batchOne 执行批量调用中的一个调用
+func (s *Server) batchOne(ctx context.Context, cc codec.Codec, call *batchCall) batchResult {
+	method, ok := s.lookupMethod(call.Service, call.Method)
+	if !ok {
+		return batchError(Errorf(CodeNotFound, "rpc server: method not found %s.%s", call.Service, call.Method))
+	}
+	if err := checkMethodTypes(cc, cc, method); err != nil {
+		return batchError(Errorf(CodeInvalidArgument, "rpc server: method %s.%s: %v", call.Service, call.Method, err))
+	}
+	argv := method.newArgv()
+	arg := argv.Interface()
+	if argv.Kind() != reflect.Ptr {
+		arg = argv.Addr().Interface()
+	}
+	if err := cc.Decode(call.Arg, arg); err != nil {
+		return batchError(Errorf(CodeInvalidArgument, "rpc server: decode argument failed: %v", err))
+	}
+	resp, err := s.invoke(ctx, call.Service, method, arg)
+	if err != nil {
+		return batchError(err)
+	}
+	reply, err := cc.Encode(resp)
+	if err != nil {
+		return batchError(Errorf(CodeInternal, "rpc server: encode reply failed: %v", err))
+	}
+	return batchResult{Code: CodeOK, Reply: reply}
+}
+
+// batchError 失败的调用的结果，错误码总是设置，客户端根据错误码判断是否成功
+// 错误信息可能为空，不能用它来判断
+func batchError(err error) batchResult {
+	code := CodeOf(err)
+	if code == "" || code == CodeOK {
+		code = CodeUnknown
+	}
+	return batchResult{Code: code, Error: err.Error(), RetryAfter: RetryAfterOf(err)}
+}
+
+// BatchCall 批量调用中的一个调用
+type BatchCall struct {
+	Service string
+	Method  string
+	Arg     any   // 参数
+	Reply   any   // 返回值指针
+	Error   error // 这个调用的错误，Batch 返回后有效
+}
+
+// Batch 把多个调用合并为一个请求发送给同一个服务端
+// 每个调用的结果写入各自的 Reply 和 Error，某个调用失败不影响其他调用
+// 使用注册中心时，根据第一个调用的服务名选择服务端
+// 设置了重试策略时只在整个请求被拒绝时重试，已经执行的调用不会被重复执行
+// 参数:
+//   - ctx: 上下文
+//   - calls: 要执行的调用
+//   - ordered: 为 true 时服务端按顺序依次执行，否则并发执行
+//
+// 返回值:
+//   - error: 整个请求失败时的错误，此时每个调用的 Error 都是这个错误
+func (c *Client) Batch(ctx context.Context, calls []*BatchCall, ordered bool) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	ctx = ensureRequestID(ctx)
+	err := withRetry(ctx, c.Opt.Retry, func() error {
+		addr := c.TargetAddr
+		if c.Opt.UseRegistry {
+			var err error
+			addr, err = c.getAddr(calls[0].Service)
+			if err != nil {
+				c.logger().Error("rpc client: get addr failed", "err", err)
+				return err
+			}
+		}
+		return c.batch(ctx, addr, calls, ordered)
+	})
+	if err != nil {
+		for _, call := range calls {
+			call.Error = err
+		}
+	}
+	return err
+}
+
+// batch 发送一次批量请求，返回整个请求的错误
+func (c *Client) batch(ctx context.Context, addr string, calls []*BatchCall, ordered bool) (err error) {
+	dones := make([]func(error) time.Duration, len(calls))
+	for i, call := range calls {
+		dones[i] = observeCall(clientRequests, clientDuration, clientInFlight, call.Service, call.Method)
+	}
+	ctx, span := startSpan(ctx, c.Opt.Tracer, "batch", SpanKindClient)
+	span.SetAttribute("rpc.system", "gorpc")
+	span.SetAttribute("rpc.batch.size", len(calls))
+	span.SetAttribute("server.address", addr)
+	start := time.Now()
+	defer func() {
+		for i, call := range calls {
+			callErr := err
+			if callErr == nil {
+				callErr = call.Error
+			}
+			dones[i](callErr)
+		}
+		span.End(err)
+		attrs := []any{"size", len(calls), "ordered", ordered, "peer", addr}
+		if id, ok := RequestIDFromContext(ctx); ok {
+			attrs = append(attrs, "request_id", id)
+		}
+		logCall(c.logger(), c.Opt.AccessLog, "rpc client: batch", attrs, time.Since(start), err)
+	}()
+
+	header, err := json.Marshal(Header{Option: c.Opt})
+	if err != nil {
+		return err
+	}
+	req := batchRequest{Ordered: ordered, Calls: make([]batchCall, len(calls))}
+	for i, call := range calls {
+		arg, err := c.cc.Encode(call.Arg)
+		if err != nil {
+			return fmt.Errorf("rpc client: encode argument of %s.%s failed: %w", call.Service, call.Method, err)
+		}
+		req.Calls[i] = batchCall{Service: call.Service, Method: call.Method, Arg: arg}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := c.sendReq(ctx, TypeBatch, addr, BatchPath, "application/json", header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := c.responseBody(resp)
+	if err != nil {
+		return err
+	}
+	defer respBody.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, err := io.ReadAll(respBody)
+		if err != nil {
+			return err
+		}
+		return responseError(resp, b)
+	}
+	var result batchResponse
+	if err := json.NewDecoder(respBody).Decode(&result); err != nil {
+		return fmt.Errorf("rpc client: decode batch response failed: %w", err)
+	}
+	if len(result.Results) != len(calls) {
+		return fmt.Errorf("rpc client: batch response has %d results, expected %d", len(result.Results), len(calls))
+	}
+	for i, call := range calls {
+		r := &result.Results[i]
+		if r.Code != CodeOK {
+			call.Error = &Error{Code: r.Code, Message: r.Error, RetryAfter: r.RetryAfter}
+			continue
+		}
+		call.Error = c.cc.Decode(r.Reply, call.Reply)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package gorpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	_, addr := startTestServer(t)
+	for _, ordered := range []bool{true, false} {
+		calls := []*BatchCall{
+			{Service: testServiceName, Method: "Add", Arg: &testArgs{A: 1, B: 2}, Reply: &testReply{}},
+			// 错误信息为空的失败也要报告为失败
+			{Service: testServiceName, Method: "Fail", Arg: &testArgs{}, Reply: &testReply{}},
+			{Service: testServiceName, Method: "Fail", Arg: &testArgs{Name: "boom"}, Reply: &testReply{}},
+			{Service: testServiceName, Method: "Missing", Arg: &testArgs{}, Reply: &testReply{}},
+		}
+		if err := NewClient(addr).Batch(context.Background(), calls, ordered); err != nil {
+			t.Fatal(err)
+		}
+		if calls[0].Error != nil || calls[0].Reply.(*testReply).Sum != 3 {
+			t.Errorf("ordered=%v: Add got %+v, %v", ordered, calls[0].Reply, calls[0].Error)
+		}
+		if CodeOf(calls[1].Error) != CodeUnknown {
+			t.Errorf("ordered=%v: empty error got %v", ordered, calls[1].Error)
+		}
+		if calls[2].Error == nil || calls[2].Error.Error() != "boom" {
+			t.Errorf("ordered=%v: Fail got %v", ordered, calls[2].Error)
+		}
+		if CodeOf(calls[3].Error) != CodeNotFound {
+			t.Errorf("ordered=%v: Missing got %v", ordered, calls[3].Error)
+		}
+	}
+}
+
+func TestParallelBounded(t *testing.T) {
+	const n, workers = 100, 4
+	var running, peak atomic.Int32
+	var mu sync.Mutex
+	done := make([]bool, n)
+	parallel(n, workers, func(i int) {
+		cur := running.Add(1)
+		for {
+			p := peak.Load()
+			if cur <= p || peak.CompareAndSwap(p, cur) {
+				break
+			}
+		}
+		mu.Lock()
+		done[i] = true
+		mu.Unlock()
+		running.Add(-1)
+	})
+	if p := peak.Load(); p > workers {
+		t.Errorf("peak concurrency %d exceeds %d workers", p, workers)
+	}
+	for i, ok := range done {
+		if !ok {
+			t.Fatalf("f(%d) was not called", i)
+		}
+	}
+}
@@ -0,0 +1,710 @@
+package gorpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+// 双向流式调用
+// 方法的形式为 func(stream gorpc.BidiStream[Req, Resp]) error，也可以在最前面加上 ctx context.Context
+// 客户端通过 WebSocket 升级连接，之后双方都可以随时发送消息，直到服务端方法返回
+// 每个 WebSocket 消息是一个与服务端流相同格式的帧，消息帧的内容使用请求的编解码器编码
+// 流量控制: 双方各自通过窗口帧告诉对方还可以发送多少个消息，接收方取走一半窗口的消息后补充窗口
+// 半关闭: 客户端发送 CloseSend 帧后服务端的 Recv 返回 io.EOF，服务端仍然可以继续发送
+// 超时: 客户端 ctx 的剩余时间通过 TimeoutHeader 传给服务端，服务端方法的 ctx 在同一时间结束
+
+const (
+	BidiStreamPath = "/bidi"
+	// TimeoutHeader 双向流请求中 ctx 的剩余时间，格式与 time.Duration.String() 相同
+	TimeoutHeader = "X-Timeout"
+	// DefaultStreamWindow 默认的接收窗口
+	DefaultStreamWindow = 64
+)
+
+// BidiStream 双向流式方法用来接收和发送消息
+// 只在方法返回之前有效，Recv 和 Send 可以在不同的协程中同时调用，多个协程也可以同时调用 Send
+type BidiStream[Req, Resp any] struct {
+	s *bidiConn
+}
+
+// Recv 接收客户端发送的下一个消息，客户端半关闭之后返回 io.EOF
+func (s BidiStream[Req, Resp]) Recv() (*Req, error) {
+	msg := new(Req)
+	if err := s.s.recv(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Send 发送一个消息，对方的接收窗口已满时等待
+// 客户端断开或者调用的上下文结束时返回错误，此时方法应该尽快返回
+func (s BidiStream[Req, Resp]) Send(msg *Resp) error {
+	return s.s.send(msg)
+}
+
+// Context 调用的上下文，带有调用方的信息和 span
+func (s BidiStream[Req, Resp]) Context() context.Context {
+	return s.s.context()
+}
+
+// rawBidiStream 与所有的 BidiStream[Req, Resp] 有相同的底层类型，用于通过反射创建 BidiStream[Req, Resp]
+type rawBidiStream struct {
+	s *bidiConn
+}
+
+var rawBidiStreamType = reflect.TypeOf(rawBidiStream{})
+
+// bidiStreamElems 判断参数是否为 BidiStream[Req, Resp]，是时返回 Recv 的返回值类型 *Req 和 Send 的参数类型 *Resp
+func bidiStreamElems(t reflect.Type) (reflect.Type, reflect.Type, bool) {
+	if t.Kind() != reflect.Struct || t.PkgPath() != rawBidiStreamType.PkgPath() ||
+		!strings.HasPrefix(t.Name(), "BidiStream[") || !rawBidiStreamType.ConvertibleTo(t) {
+		return nil, nil, false
+	}
+	recv, ok := t.MethodByName("Recv")
+	if !ok {
+		return nil, nil, false
+	}
+	send, ok := t.MethodByName("Send")
+	if !ok {
+		return nil, nil, false
+	}
+	return recv.Type.Out(0), send.Type.In(1), true
+}
+
+// bidiMethod 判断方法是否为双向流式方法，是时返回对应的方法表项
+func bidiMethod(method reflect.Method, receiver any) (*Method, bool) {
+	n := method.Type.NumIn()
+	withContext := n == 3 && method.Type.In(1) == contextType
+	if n != 2 && !withContext {
+		return nil, false
+	}
+	streamType := method.Type.In(n - 1)
+	argType, retType, ok := bidiStreamElems(streamType)
+	if !ok {
+		return nil, false
+	}
+	return &Method{
+		method:      method,
+		ArgType:     argType,
+		RetType:     retType,
+		Receiver:    reflect.ValueOf(receiver),
+		withContext: withContext,
+		streamType:  streamType,
+		bidi:        true,
+	}, true
+}
+
+type bidiStreamKey struct{}
+
+// bidiConn 双向流的一端，服务端和客户端共用
+// 读协程不断读取对方的帧，消息放入 msgs，窗口帧增加 credits
+type bidiConn struct {
+	side    string // 错误信息的前缀，rpc server 或 rpc client
+	conn    *websocket.Conn
+	cc      codec.Codec
+	maxSize int64
+	window  int // 自己的接收窗口
+
+	writeMutex sync.Mutex
+	// 同一时间只有一个 send 等待窗口，creditCh 的容量为1也不会漏掉通知
+	sendMutex sync.Mutex
+
+	mutex    sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	msgs     chan []byte   // 收到还没有被取走的消息，容量为 window
+	recvErr  error         // msgs 关闭的原因，对方半关闭或者正常结束时为 io.EOF
+	consumed int           // 已经取走但还没有补充给对方的窗口
+	credits  int           // 还可以发送的消息数
+	creditCh chan struct{} // credits 增加时通知等待的 send
+	sendErr  error         // 不为 nil 时不能再发送
+	done     chan struct{} // 读协程退出时关闭
+	trailer  *streamTrailer
+}
+
+func newBidiConn(ctx context.Context, side string, conn *websocket.Conn, cc codec.Codec, maxSize int64, window int) *bidiConn {
+	if window <= 0 {
+		window = DefaultStreamWindow
+	}
+	if maxSize > 0 {
+		// 帧头占5字节
+		conn.SetReadLimit(maxSize + 5)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &bidiConn{
+		side:     side,
+		conn:     conn,
+		cc:       cc,
+		maxSize:  maxSize,
+		window:   window,
+		ctx:      ctx,
+		cancel:   cancel,
+		msgs:     make(chan []byte, window),
+		creditCh: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// start 开始读取对方的帧，并把自己的接收窗口告诉对方
+func (c *bidiConn) start() error {
+	go c.readLoop()
+	return c.writeWindow(c.window)
+}
+
+// deadline 写超时，即上下文的截止时间，没有时为零值
+func (c *bidiConn) deadline() time.Time {
+	d, _ := c.context().Deadline()
+	return d
+}
+
+func (c *bidiConn) context() context.Context {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ctx
+}
+
+// readLoop 读协程，出错或者收到结束帧时退出
+func (c *bidiConn) readLoop() {
+	for {
+		_, r, err := c.conn.NextReader()
+		if err != nil {
+			c.stop(fmt.Errorf("%s: read stream failed: %w", c.side, err))
+			return
+		}
+		typ, payload, err := readFrame(r, c.maxSize)
+		if err != nil {
+			c.stop(fmt.Errorf("%s: read stream failed: %w", c.side, err))
+			return
+		}
+		switch typ {
+		case frameMessage:
+			if !c.push(payload) {
+				return
+			}
+		case frameWindow:
+			if len(payload) != 4 {
+				c.stop(fmt.Errorf("%s: invalid window frame", c.side))
+				return
+			}
+			c.addCredits(int(binary.BigEndian.Uint32(payload)))
+		case frameCloseSend:
+			c.closeRecv(io.EOF)
+		case frameEnd:
+			var trailer streamTrailer
+			if err := json.Unmarshal(payload, &trailer); err != nil {
+				c.stop(fmt.Errorf("%s: decode stream trailer failed: %w", c.side, err))
+				return
+			}
+			c.mutex.Lock()
+			c.trailer = &trailer
+			c.mutex.Unlock()
+			if trailer.Error != "" {
+				c.closeRecv(&Error{Code: trailer.Code, Message: trailer.Error, RetryAfter: trailer.RetryAfter})
+			}
+			// 对方已经结束，之后的发送返回 io.EOF
+			c.stop(io.EOF)
+			return
+		default:
+			c.stop(fmt.Errorf("%s: unknown stream frame type %d", c.side, typ))
+			return
+		}
+	}
+}
+
+// push 把收到的消息交给 recv，对方超过窗口时停止读取
+func (c *bidiConn) push(payload []byte) bool {
+	c.mutex.Lock()
+	closed := c.recvErr != nil
+	c.mutex.Unlock()
+	if closed {
+		c.stop(fmt.Errorf("%s: message received after the peer closed sending", c.side))
+		return false
+	}
+	select {
+	case c.msgs <- payload:
+		return true
+	default:
+		c.stop(fmt.Errorf("%s: peer exceeded the flow control window of %d messages", c.side, c.window))
+		return false
+	}
+}
+
+// closeRecv 不会再有新的消息，取完已有的消息之后 recv 返回 err
+func (c *bidiConn) closeRecv(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.recvErr != nil {
+		return
+	}
+	c.recvErr = err
+	close(c.msgs)
+}
+
+// stop 读协程退出，err 为 io.EOF 表示对方正常结束
+// 其他错误说明连接已经不可用，取消上下文让方法尽快返回
+func (c *bidiConn) stop(err error) {
+	c.closeRecv(err)
+	c.mutex.Lock()
+	if c.sendErr == nil {
+		c.sendErr = err
+	}
+	c.mutex.Unlock()
+	close(c.done)
+	if !errors.Is(err, io.EOF) {
+		c.cancel()
+	}
+}
+
+func (c *bidiConn) addCredits(n int) {
+	c.mutex.Lock()
+	c.credits += n
+	c.mutex.Unlock()
+	select {
+	case c.creditCh <- struct{}{}:
+	default:
+	}
+}
+
+// recv 接收一个消息并解码到 msg
+func (c *bidiConn) recv(msg any) error {
+	ctx := c.context()
+	var payload []byte
+	select {
+	case p, ok := <-c.msgs:
+		if !ok {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			return c.recvErr
+		}
+		payload = p
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// 取走一半窗口的消息之后补充窗口，减少窗口帧的数量
+	c.mutex.Lock()
+	c.consumed++
+	n := 0
+	if c.consumed >= (c.window+1)/2 {
+		n, c.consumed = c.consumed, 0
+	}
+	c.mutex.Unlock()
+	if n > 0 {
+		// 发送失败时连接已经不可用，读协程会发现
+		_ = c.writeWindow(n)
+	}
+	if err := c.cc.Decode(payload, msg); err != nil {
+		return fmt.Errorf("%s: decode stream message failed: %w", c.side, err)
+	}
+	return nil
+}
+
+// send 编码并发送一个消息，没有窗口时等待对方补充
+// 可以在多个协程中同时调用，消息按获得 sendMutex 的顺序发送
+func (c *bidiConn) send(msg any) error {
+	b, err := c.cc.Encode(msg)
+	if err != nil {
+		return err
+	}
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	ctx := c.context()
+	for {
+		c.mutex.Lock()
+		if c.sendErr != nil {
+			err := c.sendErr
+			c.mutex.Unlock()
+			return err
+		}
+		if c.credits > 0 {
+			c.credits--
+			c.mutex.Unlock()
+			break
+		}
+		c.mutex.Unlock()
+		select {
+		case <-c.creditCh:
+		case <-c.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return c.write(frameMessage, b, c.deadline())
+}
+
+func (c *bidiConn) writeWindow(n int) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	return c.write(frameWindow, b[:], c.deadline())
+}
+
+// write 把一个帧作为一个 WebSocket 消息发送
+func (c *bidiConn) write(typ byte, payload []byte, deadline time.Time) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_ = c.conn.SetWriteDeadline(deadline)
+	w, err := c.conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		return err
+	}
+	if err := writeFrame(w, typ, payload); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// errSendClosed 半关闭之后调用 Send 的错误，流仍然可以继续接收
+var errSendClosed = errors.New("rpc client: send after CloseSend")
+
+// closeSend 客户端半关闭
+func (c *bidiConn) closeSend() error {
+	c.mutex.Lock()
+	if c.sendErr != nil {
+		err := c.sendErr
+		c.mutex.Unlock()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	c.sendErr = errSendClosed
+	c.mutex.Unlock()
+	return c.write(frameCloseSend, nil, c.deadline())
+}
+
+// close 发送 WebSocket 关闭消息并关闭连接
+// WriteControl 可以与其他写操作同时调用，不需要持有 writeMutex
+func (c *bidiConn) close() error {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.cancel()
+	return c.conn.Close()
+}
+
+// finish 服务端方法返回后发送结束帧并关闭连接
+func (c *bidiConn) finish(s *Server, callErr error) {
+	defer c.close()
+	var trailer streamTrailer
+	if callErr != nil {
+		// 超时作为 DeadlineExceeded 返回给客户端
+		var e *Error
+		if !errors.As(callErr, &e) && errors.Is(callErr, context.DeadlineExceeded) {
+			callErr = &Error{Code: CodeDeadlineExceeded, Message: callErr.Error()}
+		}
+		trailer = streamTrailer{Error: callErr.Error(), Code: CodeOf(callErr), RetryAfter: RetryAfterOf(callErr)}
+	}
+	b, err := json.Marshal(trailer)
+	if err != nil {
+		s.logger().Error("rpc server: marshal stream trailer failed", "err", err)
+		return
+	}
+	// 上下文可能已经超时，结束帧单独设置写超时
+	if err := c.write(frameEnd, b, time.Now().Add(time.Second)); err != nil {
+		s.logger().Error("rpc server: write stream trailer failed", "err", err)
+	}
+}
+
+var bidiUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// bidi 处理双向流式调用的 WebSocket 升级请求
+func (s *Server) bidi(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Type") != TypeBidi {
+		s.logger().Error("rpc server: wrong message type", "type", r.Header.Get("X-Type"), "peer", r.RemoteAddr)
+		s.sendErr(w, fmt.Errorf("rpc server: wrong message type"), http.StatusBadRequest)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		w.Header().Set("Upgrade", "websocket")
+		s.sendErr(w, fmt.Errorf("rpc server: expected upgrade to websocket"), http.StatusUpgradeRequired)
+		return
+	}
+	ctx, err := s.authenticate(w, r)
+	if err != nil {
+		s.logger().Error("rpc server: authenticate failed", "err", err)
+		s.sendAuthErr(w, err)
+		return
+	}
+	header, err := s.parseHeader(r)
+	if err != nil {
+		s.logger().Error("rpc server: parse header failed", "err", err)
+		s.sendErr(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := s.validateReq(header); err != nil {
+		s.sendErr(w, err, HTTPStatus(CodeOf(err)))
+		return
+	}
+	method, _ := s.lookupMethod(header.Service, header.Method)
+	if !method.bidi {
+		s.sendErr(w, Errorf(CodeInvalidArgument, "rpc server: %s.%s is not a bidirectional streaming method", header.Service, header.Method), http.StatusBadRequest)
+		return
+	}
+	cc := codec.NewCodec(header.Option.CodecType)
+	if cc == nil {
+		s.sendErr(w, fmt.Errorf("rpc server: unsupported codec type %s", header.Option.CodecType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err := checkMethodTypes(cc, cc, method); err != nil {
+		s.sendErr(w, fmt.Errorf("rpc server: method %s.%s: %w", header.Service, header.Method, err), http.StatusBadRequest)
+		return
+	}
+	if t := r.Header.Get(TimeoutHeader); t != "" {
+		timeout, err := time.ParseDuration(t)
+		if err != nil {
+			s.sendErr(w, Errorf(CodeInvalidArgument, "rpc server: invalid timeout %s", t), http.StatusBadRequest)
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 响应头中带上认证时设置的请求 ID
+	conn, err := bidiUpgrader.Upgrade(w, r, w.Header())
+	if err != nil {
+		// Upgrade 已经发送了错误响应
+		s.logger().Error("rpc server: websocket upgrade failed", "err", err)
+		return
+	}
+	bc := newBidiConn(ctx, "rpc server", conn, cc, s.MaxBodySize, s.StreamWindow)
+	if err := bc.start(); err != nil {
+		s.logger().Error("rpc server: start stream failed", "err", err)
+		bc.close()
+		return
+	}
+	_, err = s.invoke(context.WithValue(bc.context(), bidiStreamKey{}, bc), header.Service, method, nil)
+	bc.finish(s, err)
+}
+
+// callBidi 通过反射调用双向流式方法，流在 ctx 中
+func (s *Server) callBidi(ctx context.Context, method *Method) error {
+	bc, ok := ctx.Value(bidiStreamKey{}).(*bidiConn)
+	if !ok {
+		return Errorf(CodeInvalidArgument, "rpc server: %s is a bidirectional streaming method, call it through %s", method.method.Name, BidiStreamPath)
+	}
+	bc.mutex.Lock()
+	bc.ctx = ctx
+	bc.mutex.Unlock()
+	stream := reflect.ValueOf(rawBidiStream{s: bc}).Convert(method.streamType)
+	args := []reflect.Value{method.Receiver, stream}
+	if method.withContext {
+		args = []reflect.Value{method.Receiver, reflect.ValueOf(ctx), stream}
+	}
+	errRet := method.method.Func.Call(args)
+	if len(errRet) == 0 {
+		return fmt.Errorf("rpc server: no return value")
+	}
+	if err, _ := errRet[0].Interface().(error); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Stream 客户端的双向流
+// Send 和 Recv 可以在不同的协程中同时调用，多个协程可以同时调用 Send，但同一时间只能有一个协程调用 Recv
+type Stream struct {
+	ctx     context.Context
+	bc      *bidiConn
+	client  *Client
+	service string
+	method  string
+	addr    string
+	span    Span
+	done    func(error) time.Duration
+	stop    func() bool
+	once    sync.Once
+}
+
+// Stream 打开一个到服务端双向流式方法的流
+// ctx 结束时流被关闭，ctx 的截止时间同时作为服务端方法的截止时间
+// 使用完毕后需要调用 Close，或者一直调用 Recv 直到返回错误
+// 参数:
+//   - ctx: 流的上下文
+//   - service: 服务名
+//   - method: 方法名
+//
+// 返回值:
+//   - *Stream: 打开的流
+//   - error: 如果发生错误，则返回错误信息。
+func (c *Client) Stream(ctx context.Context, service, method string) (_ *Stream, err error) {
+	ctx = ensureRequestID(ctx)
+	addr := c.TargetAddr
+	if c.Opt.UseRegistry {
+		addr, err = c.getAddr(service)
+		if err != nil {
+			c.logger().Error("rpc client: get addr failed", "err", err)
+			return nil, err
+		}
+	}
+	st := &Stream{
+		client:  c,
+		service: service,
+		method:  method,
+		addr:    addr,
+		done:    observeCall(clientRequests, clientDuration, clientInFlight, service, method),
+	}
+	ctx, st.span = startSpan(ctx, c.Opt.Tracer, service+"/"+method, SpanKindClient)
+	st.span.SetAttribute("rpc.system", "gorpc")
+	st.span.SetAttribute("rpc.service", service)
+	st.span.SetAttribute("rpc.method", method)
+	st.span.SetAttribute("server.address", addr)
+	st.ctx = ctx
+	defer func() {
+		if err != nil {
+			st.end(err)
+		}
+	}()
+
+	conn, err := c.dialBidi(ctx, addr, service, method)
+	if err != nil {
+		return nil, err
+	}
+	st.bc = newBidiConn(ctx, "rpc client", conn, c.cc, c.Opt.MaxBodySize, c.Opt.StreamWindow)
+	// ctx 结束时关闭连接，服务端随之取消方法的 ctx
+	st.stop = context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	if err := st.bc.start(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// dialBidi 建立 WebSocket 连接
+func (c *Client) dialBidi(ctx context.Context, addr, service, method string) (*websocket.Conn, error) {
+	h, err := json.Marshal(Header{Service: service, Method: method, Option: c.Opt})
+	if err != nil {
+		return nil, err
+	}
+	u := baseURL(addr, c.Opt.TLSConfig) + BidiStreamPath
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Type", TypeBidi)
+	req.Header.Set("X-Header", string(h))
+	injectTrace(req.Header, spanContextFrom(ctx))
+	if id, ok := RequestIDFromContext(ctx); ok {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(TimeoutHeader, time.Until(deadline).String())
+	}
+	if c.Opt.Credentials != nil {
+		if err := c.Opt.Credentials.Apply(req, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment}
+	if c.Opt.TLSConfig != nil {
+		dialer.TLSClientConfig = c.Opt.TLSConfig.Clone()
+	} else if strings.HasPrefix(u, "https://") {
+		dialer.TLSClientConfig = &tls.Config{}
+	}
+	if dialer.TLSClientConfig != nil {
+		// Upgrade 只能在 HTTP/1.1 上进行
+		dialer.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	wsURL := "ws" + strings.TrimPrefix(u, "http")
+	conn, resp, err := dialer.DialContext(ctx, wsURL, req.Header)
+	if err != nil {
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			// 服务端在升级前拒绝了请求，响应中带有错误码
+			defer resp.Body.Close()
+			b, _ := io.ReadAll(resp.Body)
+			return nil, responseError(resp, b)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// end 流结束，记录指标、span 和日志，只有第一次调用生效
+func (st *Stream) end(err error) {
+	st.once.Do(func() {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		d := st.done(err)
+		st.span.End(err)
+		logCall(st.client.logger(), st.client.Opt.AccessLog, "rpc client: stream", callAttrs(st.ctx, st.service, st.method, st.addr), d, err)
+		if st.bc != nil {
+			st.stop()
+			st.bc.close()
+		}
+	})
+}
+
+// Send 发送一个消息，服务端的接收窗口已满时等待
+// 服务端已经结束时返回 io.EOF，此时通过 Recv 获取结束的原因，CloseSend 之后返回错误但不关闭流
+func (st *Stream) Send(msg any) error {
+	err := st.bc.send(msg)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, errSendClosed) {
+		if ctxErr := st.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		st.end(err)
+	}
+	return err
+}
+
+// Recv 接收服务端发送的下一个消息并解码到 msg
+// 服务端方法成功返回后返回 io.EOF，方法返回错误时返回 *Error，之后流被关闭
+func (st *Stream) Recv(msg any) error {
+	err := st.bc.recv(msg)
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if !errors.Is(err, io.EOF) && !errors.As(err, &e) {
+		if ctxErr := st.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+	}
+	st.end(err)
+	return err
+}
+
+// CloseSend 半关闭，告诉服务端不会再发送消息，之后仍然可以调用 Recv
+func (st *Stream) CloseSend() error {
+	return st.bc.closeSend()
+}
+
+// Close 关闭流，服务端还没有结束时方法的 ctx 被取消
+func (st *Stream) Close() error {
+	err := context.Canceled
+	st.bc.mutex.Lock()
+	if t := st.bc.trailer; t != nil {
+		err = nil
+		if t.Error != "" {
+			err = &Error{Code: t.Code, Message: t.Error, RetryAfter: t.RetryAfter}
+		}
+	}
+	st.bc.mutex.Unlock()
+	st.end(err)
+	return nil
+}
+
+// Context 流的上下文，带有请求 ID 和 span
+func (st *Stream) Context() context.Context {
+	return st.ctx
+}
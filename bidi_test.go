@@ -0,0 +1,350 @@
+package gorpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 双向流式方法，客户端和服务端之间经过真实的 WebSocket 连接
+
+var (
+	// Hold 在收到值之后才开始接收消息
+	testBidiRelease = make(chan struct{})
+	// Wait 和 Drain 结束时发送结束的原因
+	testBidiDone = make(chan error, 1)
+)
+
+// Echo 对每个消息回复 A+B，客户端半关闭之后回复 Name 为 "eof"、Sum 为收到的消息数
+// Name 以 "error:" 开头时返回以剩余部分为信息的错误
+func (t *testService) Echo(stream BidiStream[testArgs, testReply]) error {
+	n := 0
+	for {
+		args, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.Send(&testReply{Sum: n, Name: "eof"})
+		}
+		if err != nil {
+			return err
+		}
+		if msg, ok := strings.CutPrefix(args.Name, "error:"); ok {
+			return errors.New(msg)
+		}
+		n++
+		if err := stream.Send(&testReply{Sum: args.A + args.B, Name: args.Name}); err != nil {
+			return err
+		}
+	}
+}
+
+// Hold 等到 testBidiRelease 之后再接收消息，半关闭之后回复收到的消息数
+func (t *testService) Hold(stream BidiStream[testArgs, testReply]) error {
+	select {
+	case <-testBidiRelease:
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+	n := 0
+	for {
+		if _, err := stream.Recv(); errors.Is(err, io.EOF) {
+			return stream.Send(&testReply{Sum: n})
+		} else if err != nil {
+			return err
+		}
+		n++
+	}
+}
+
+// Wait 回复一个消息说明上下文是否有截止时间，之后一直等到上下文结束
+func (t *testService) Wait(ctx context.Context, stream BidiStream[testArgs, testReply]) error {
+	_, ok := ctx.Deadline()
+	if err := stream.Send(&testReply{Name: fmt.Sprint(ok)}); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	testBidiDone <- ctx.Err()
+	return ctx.Err()
+}
+
+// Drain 一直接收到出错为止
+func (t *testService) Drain(stream BidiStream[testArgs, testReply]) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			testBidiDone <- err
+			return err
+		}
+	}
+}
+
+// Vanish 回复一个消息之后直接关闭底层连接，不发送结束帧
+func (t *testService) Vanish(stream BidiStream[testArgs, testReply]) error {
+	if err := stream.Send(&testReply{Name: "bye"}); err != nil {
+		return err
+	}
+	stream.s.conn.UnderlyingConn().Close()
+	<-stream.Context().Done()
+	return stream.Context().Err()
+}
+
+// withStreamWindow 在测试期间设置共用服务端的接收窗口
+func withStreamWindow(t *testing.T, s *Server, window int) {
+	t.Helper()
+	old := s.StreamWindow
+	s.StreamWindow = window
+	t.Cleanup(func() { s.StreamWindow = old })
+}
+
+func openTestStream(t *testing.T, ctx context.Context, method string) *Stream {
+	t.Helper()
+	st, err := newTestStubClient(t).Stream(ctx, testServiceName, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestBidiEcho(t *testing.T) {
+	startTestServer(t)
+	st := openTestStream(t, testContext(t), "Echo")
+	for i := range 10 {
+		if err := st.Send(&testArgs{A: i, B: 1, Name: "x"}); err != nil {
+			t.Fatal(err)
+		}
+		var reply testReply
+		if err := st.Recv(&reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.Sum != i+1 || reply.Name != "x" {
+			t.Fatalf("reply %d = %+v", i, reply)
+		}
+	}
+	// 半关闭之后服务端的 Recv 返回 io.EOF，服务端仍然可以发送
+	if err := st.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Send(&testArgs{}); err == nil {
+		t.Fatal("Send after CloseSend should fail")
+	}
+	var reply testReply
+	if err := st.Recv(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Name != "eof" || reply.Sum != 10 {
+		t.Fatalf("reply after CloseSend = %+v", reply)
+	}
+	if err := st.Recv(&reply); !errors.Is(err, io.EOF) {
+		t.Fatalf("Recv after the method returned: %v", err)
+	}
+}
+
+// 服务端方法返回的错误作为结束帧中的错误交给客户端
+func TestBidiHandlerError(t *testing.T) {
+	startTestServer(t)
+	st := openTestStream(t, testContext(t), "Echo")
+	if err := st.Send(&testArgs{Name: "error:boom"}); err != nil {
+		t.Fatal(err)
+	}
+	err := st.Recv(&testReply{})
+	var e *Error
+	if !errors.As(err, &e) || e.Code != CodeUnknown || e.Message != "boom" {
+		t.Fatalf("Recv = %v", err)
+	}
+	// 服务端已经结束，之后的发送返回 io.EOF
+	if err := st.Send(&testArgs{}); !errors.Is(err, io.EOF) {
+		t.Fatalf("Send after the method returned: %v", err)
+	}
+}
+
+// 服务端不接收时客户端最多发送一个窗口的消息，服务端取走消息补充窗口后继续发送
+func TestBidiFlowControl(t *testing.T) {
+	s, _ := startTestServer(t)
+	const window, total = 4, 20
+	withStreamWindow(t, s, window)
+	st := openTestStream(t, testContext(t), "Hold")
+
+	var mutex sync.Mutex
+	sent := 0
+	sendDone := make(chan error, 1)
+	go func() {
+		for range total {
+			if err := st.Send(&testArgs{}); err != nil {
+				sendDone <- err
+				return
+			}
+			mutex.Lock()
+			sent++
+			mutex.Unlock()
+		}
+		sendDone <- st.CloseSend()
+	}()
+	count := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return sent
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for count() < window && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// 窗口用完之后 Send 一直等待
+	time.Sleep(50 * time.Millisecond)
+	if n := count(); n != window {
+		t.Fatalf("sent %d messages before the server received any, want %d", n, window)
+	}
+
+	testBidiRelease <- struct{}{}
+	if err := <-sendDone; err != nil {
+		t.Fatal(err)
+	}
+	var reply testReply
+	if err := st.Recv(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Sum != total {
+		t.Fatalf("server received %d messages, want %d", reply.Sum, total)
+	}
+}
+
+// 多个协程同时调用 Send，窗口很小时需要反复等待窗口
+func TestBidiConcurrentSend(t *testing.T) {
+	s, _ := startTestServer(t)
+	withStreamWindow(t, s, 2)
+	st := openTestStream(t, testContext(t), "Echo")
+	const senders, each = 8, 50
+
+	replies := make(chan testReply, senders*each+1)
+	recvDone := make(chan error, 1)
+	go func() {
+		for {
+			var reply testReply
+			if err := st.Recv(&reply); err != nil {
+				recvDone <- err
+				return
+			}
+			replies <- reply
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range each {
+				if err := st.Send(&testArgs{A: i * each, B: j}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := st.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-recvDone; !errors.Is(err, io.EOF) {
+		t.Fatalf("Recv: %v", err)
+	}
+	close(replies)
+	seen := make(map[int]bool)
+	var eof *testReply
+	for reply := range replies {
+		if reply.Name == "eof" {
+			eof = &reply
+			continue
+		}
+		if seen[reply.Sum] {
+			t.Fatalf("duplicate reply %d", reply.Sum)
+		}
+		seen[reply.Sum] = true
+	}
+	if len(seen) != senders*each || eof == nil || eof.Sum != senders*each {
+		t.Fatalf("got %d replies, eof %+v", len(seen), eof)
+	}
+}
+
+// 客户端 ctx 的截止时间通过 TimeoutHeader 传给服务端，到期时双方都结束
+func TestBidiDeadline(t *testing.T) {
+	startTestServer(t)
+	drainBidiDone()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	st := openTestStream(t, ctx, "Wait")
+	var reply testReply
+	if err := st.Recv(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Name != "true" {
+		t.Fatal("server ctx has no deadline")
+	}
+	err := st.Recv(&reply)
+	if CodeOf(err) != CodeDeadlineExceeded && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Recv after the deadline: %v", err)
+	}
+	select {
+	case err := <-testBidiDone:
+		// 服务端按照自己的截止时间结束，或者因为连接关闭被取消
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+			t.Fatalf("server ctx ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server method did not return")
+	}
+}
+
+// 客户端不半关闭直接关闭流时，服务端的 Recv 返回错误而不是 io.EOF
+func TestBidiClientGoesAway(t *testing.T) {
+	startTestServer(t)
+	drainBidiDone()
+	st := openTestStream(t, testContext(t), "Drain")
+	if err := st.Send(&testArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+	select {
+	case err := <-testBidiDone:
+		if err == nil || errors.Is(err, io.EOF) {
+			t.Fatalf("server Recv after the client went away: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server method did not return")
+	}
+}
+
+// 服务端的连接断开时客户端的 Recv 和 Send 返回错误，不会一直等待
+func TestBidiServerGoesAway(t *testing.T) {
+	startTestServer(t)
+	st := openTestStream(t, testContext(t), "Vanish")
+	var reply testReply
+	if err := st.Recv(&reply); err != nil || reply.Name != "bye" {
+		t.Fatalf("Recv = %+v, %v", reply, err)
+	}
+	err := st.Recv(&reply)
+	var e *Error
+	if err == nil || errors.Is(err, io.EOF) || errors.As(err, &e) {
+		t.Fatalf("Recv after the server went away: %v", err)
+	}
+	if err := st.Send(&testArgs{}); err == nil {
+		t.Fatal("Send after the server went away should fail")
+	}
+}
+
+func drainBidiDone() {
+	select {
+	case <-testBidiDone:
+	default:
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/wifi32767/HTTPGoRpc/codec"
+	"github.com/wifi32767/HTTPGoRpc/compress"
 )
 
 type Client struct {
@@ -32,21 +34,29 @@ func NewClient(addr string, opts ...*Options) *Client {
 	// 解析设置
 	opt, err := parseOptions(opts...)
 	if err != nil {
-		slog.Error("rpc client: 解析选项失败", "err", err)
+		slog.Error("rpc client: parse options failed", "err", err)
 		return nil
 	}
 	// 创建编解码器
 	cc := codec.NewCodec(opt.CodecType)
 	if cc == nil {
-		slog.Error("rpc client: 创建编解码器失败")
+		loggerOrDefault(opt.Logger).Error("rpc client: unsupported codec type", "codec", opt.CodecType)
 		return nil
 	}
 
+	cli := &http.Client{}
+	if opt.TLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// http.Transport 会修改配置中的 NextProtos，复制一份避免影响 DialGob
+		transport.TLSClientConfig = opt.TLSConfig.Clone()
+		cli.Transport = transport
+	}
+
 	return &Client{
 		TargetAddr: addr,
 		Opt:        *opt,
 		cc:         cc,
-		cli:        &http.Client{},
+		cli:        cli,
 	}
 }
 
@@ -85,16 +95,21 @@ func parseOptions(opts ...*Options) (*Options, error) {
 // 返回值:
 //   - error: 如果发生错误，则返回错误信息。
 func (c *Client) Call(ctx context.Context, service, method string, arg any, ret any) error {
-	if c.Opt.UseRegistry {
-		// 从注册中心获取服务地址
-		addr, err := c.getAddr(service)
-		if err != nil {
-			slog.Error("rpc client: get addr failed", "err", err)
-			return err
+	// 同一次调用的所有重试使用相同的请求 ID
+	ctx = ensureRequestID(ctx)
+	// 设置了重试策略时，每次重试都重新从注册中心获取地址
+	return withRetry(ctx, c.Opt.Retry, func() error {
+		if c.Opt.UseRegistry {
+			// 从注册中心获取服务地址
+			addr, err := c.getAddr(service)
+			if err != nil {
+				c.logger().Error("rpc client: get addr failed", "err", err)
+				return err
+			}
+			return c.call(ctx, addr, service, method, arg, ret)
 		}
-		return c.call(ctx, addr, service, method, arg, ret)
-	}
-	return c.call(ctx, c.TargetAddr, service, method, arg, ret)
+		return c.call(ctx, c.TargetAddr, service, method, arg, ret)
+	})
 }
 
 // getAddr 从注册中心获取服务地址
@@ -102,26 +117,29 @@ func (c *Client) Call(ctx context.Context, service, method string, arg any, ret
 //   - service: 服务名
 //
 // 返回值:
-//   - string: 服务地址
+//   - string: 服务地址，服务使用 HTTPS 时带有协议
 //   - error: 如果发生错误，则返回错误信息。
 func (c *Client) getAddr(service string) (string, error) {
 	req, err := http.NewRequest("POST", c.TargetAddr+"/get", bytes.NewBufferString(service))
 	if err != nil {
-		slog.Error("rpc client: new request failed", "err", err)
+		c.logger().Error("rpc client: new request failed", "err", err)
 		return "", err
 	}
 	req.Header.Set("X-Type", TypeAsk)
 	resp, err := c.cli.Do(req)
 	if err != nil {
-		slog.Error("rpc client: send request failed", "err", err)
+		c.logger().Error("rpc client: send request failed", "err", err)
 		return "", err
 	}
 	defer resp.Body.Close()
 	addr, err := io.ReadAll(resp.Body)
 	if err != nil {
-		slog.Error("rpc client: read response failed", "err", err)
+		c.logger().Error("rpc client: read response failed", "err", err)
 		return "", err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("[%d] %s", resp.StatusCode, addr)
+	}
 	return string(addr), nil
 }
 
@@ -136,7 +154,18 @@ func (c *Client) getAddr(service string) (string, error) {
 //
 // 返回值:
 //   - error: 如果发生错误，则返回错误信息。
-func (c *Client) call(ctx context.Context, addr, service, method string, arg any, ret any) error {
+func (c *Client) call(ctx context.Context, addr, service, method string, arg any, ret any) (err error) {
+	done := observeCall(clientRequests, clientDuration, clientInFlight, service, method)
+	ctx, span := startSpan(ctx, c.Opt.Tracer, service+"/"+method, SpanKindClient)
+	span.SetAttribute("rpc.system", "gorpc")
+	span.SetAttribute("rpc.service", service)
+	span.SetAttribute("rpc.method", method)
+	span.SetAttribute("server.address", addr)
+	defer func() {
+		d := done(err)
+		span.End(err)
+		logCall(c.logger(), c.Opt.AccessLog, "rpc client: call", callAttrs(ctx, service, method, addr), d, err)
+	}()
 	// 创建请求头
 	h := Header{
 		Service: service,
@@ -145,17 +174,15 @@ func (c *Client) call(ctx context.Context, addr, service, method string, arg any
 	}
 	header, err := json.Marshal(h)
 	if err != nil {
-		slog.Error("rpc client: marshal header failed", "err", err)
 		return err
 	}
 	// 创建请求体
 	body, err := c.cc.Encode(arg)
 	if err != nil {
-		slog.Error("rpc client: encode failed", "err", err)
 		return err
 	}
 	// 发送请求
-	resp, err := c.sendReq(ctx, TypeCall, addr, header, body)
+	resp, err := c.sendReq(ctx, TypeCall, addr, "/call", codec.MIMEType(c.Opt.CodecType), header, body)
 	if err != nil {
 		return err
 	}
@@ -173,28 +200,93 @@ func (c *Client) call(ctx context.Context, addr, service, method string, arg any
 //   - ctx: 上下文
 //   - typ: 请求类型
 //   - addr: 服务地址
+//   - path: 请求的路径
+//   - contentType: 请求体的类型
 //   - header: 请求头
 //   - body: 请求体
 //
 // 返回值:
 //   - *http.Response: HTTP 响应
 //   - error: 如果发生错误，则返回错误信息。
-func (c *Client) sendReq(ctx context.Context, typ, addr string, header, body []byte) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+addr+"/call", bytes.NewBuffer(body))
+func (c *Client) sendReq(ctx context.Context, typ, addr, path, contentType string, header, body []byte) (*http.Response, error) {
+	body, enc, err := c.compressBody(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL(addr, c.Opt.TLSConfig)+path, bytes.NewBuffer(body))
 	if err != nil {
-		slog.Error("rpc client: new request failed", "err", err)
 		return nil, err
 	}
+	if enc != "" {
+		req.Header.Set("Content-Encoding", string(enc))
+	}
+	if c.Opt.Compression != "" {
+		req.Header.Set("Accept-Encoding", string(c.Opt.Compression))
+	}
 	req.Header.Set("X-Type", typ)
 	req.Header.Set("X-Header", string(header))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", c.accept())
+	injectTrace(req.Header, spanContextFrom(ctx))
+	if id, ok := RequestIDFromContext(ctx); ok {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	if c.Opt.Credentials != nil {
+		if err := c.Opt.Credentials.Apply(req, body); err != nil {
+			return nil, err
+		}
+	}
 	resp, err := c.cli.Do(req)
 	if err != nil {
-		slog.Error("rpc client: send request failed", "err", err)
 		return nil, err
 	}
 	return resp, nil
 }
 
+// compressBody 按照设置压缩请求体
+// 没有设置压缩器或者请求体小于压缩阈值时原样返回
+// 返回值:
+//   - []byte: 压缩后的请求体
+//   - compress.Type: 使用的压缩器类型，没有压缩时为空
+//   - error: 如果发生错误，则返回错误信息。
+func (c *Client) compressBody(body []byte) ([]byte, compress.Type, error) {
+	if c.Opt.Compression == "" {
+		return body, "", nil
+	}
+	threshold := c.Opt.CompressThreshold
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	if len(body) < threshold {
+		return body, "", nil
+	}
+	cp := compress.GetCompressor(c.Opt.Compression)
+	if cp == nil {
+		return nil, "", fmt.Errorf("rpc client: unsupported compression %s", c.Opt.Compression)
+	}
+	compressed, err := compress.Compress(cp, body)
+	if err != nil {
+		return nil, "", err
+	}
+	return compressed, c.Opt.Compression, nil
+}
+
+// accept 生成 Accept 头，CodecType 优先，其余按照 Options.Accept 的顺序降低 q 值
+func (c *Client) accept() string {
+	parts := []string{codec.MIMEType(c.Opt.CodecType)}
+	for i, t := range c.Opt.Accept {
+		if t == c.Opt.CodecType {
+			continue
+		}
+		q := 0.9 - 0.1*float64(i)
+		if q < 0.1 {
+			q = 0.1
+		}
+		parts = append(parts, fmt.Sprintf("%s;q=%.1f", codec.MIMEType(t), q))
+	}
+	return strings.Join(parts, ", ")
+}
+
 // parseResp 解析响应
 // 将响应体解码为返回值
 // 参数:
@@ -204,22 +296,81 @@ func (c *Client) sendReq(ctx context.Context, typ, addr string, header, body []b
 // 返回值:
 //   - error: 如果发生错误，则返回错误信息。
 func (c *Client) parseResp(resp *http.Response, ret any) error {
-	res, err := io.ReadAll(resp.Body)
+	body, err := c.responseBody(resp)
 	if err != nil {
-		slog.Error("rpc client: read response failed", "err", err)
 		return err
 	}
+	defer body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("[%d] %s", resp.StatusCode, res)
+		res, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		return responseError(resp, res)
+	}
+	// 服务端可能使用与请求不同的编解码器
+	cc := c.cc
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		t, ok := codec.TypeFromMIME(ct)
+		if !ok {
+			return fmt.Errorf("rpc client: unsupported content type %s", ct)
+		}
+		if t != c.Opt.CodecType {
+			cc = codec.NewCodec(t)
+			if cc == nil {
+				return fmt.Errorf("rpc client: unsupported codec type %s", t)
+			}
+		}
 	}
-	err = c.cc.Decode(res, ret)
+	err = decodeBody(cc, body, ret)
 	if err != nil {
-		slog.Error("rpc client: decode response failed", "err", err)
 		return err
 	}
 	return nil
 }
 
+// responseBody 按照 Content-Encoding 解压响应体，解压前后都限制大小
+// 关闭返回的 ReadCloser 时只关闭解压器，响应体由调用方关闭
+func (c *Client) responseBody(resp *http.Response) (io.ReadCloser, error) {
+	var body io.Reader = resp.Body
+	if c.Opt.MaxBodySize > 0 {
+		body = http.MaxBytesReader(nil, resp.Body, c.Opt.MaxBodySize)
+	}
+	ce := resp.Header.Get("Content-Encoding")
+	if ce == "" || ce == "identity" {
+		return io.NopCloser(body), nil
+	}
+	cp := compress.GetCompressor(compress.Type(ce))
+	if cp == nil {
+		return nil, fmt.Errorf("rpc client: unsupported content encoding %s", ce)
+	}
+	r, err := cp.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Opt.MaxBodySize > 0 {
+		return struct {
+			io.Reader
+			io.Closer
+		}{http.MaxBytesReader(nil, r, c.Opt.MaxBodySize), r}, nil
+	}
+	return r, nil
+}
+
+// responseError 根据非200的响应生成 *Error
+// 错误码取自 X-Code 头，没有时根据状态码推断
+func responseError(resp *http.Response, body []byte) error {
+	code := Code(resp.Header.Get("X-Code"))
+	if code == "" {
+		code = codeFromStatus(resp.StatusCode)
+	}
+	return &Error{
+		Code:       code,
+		Message:    fmt.Sprintf("[%d] %s", resp.StatusCode, body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
 // AsyncCall 异步调用 RPC 服务
 // 参数:
 //   - ctx: 上下文
@@ -0,0 +1,391 @@
+// gorpc-gen 根据 Go 接口声明生成类型化的客户端和服务端注册函数
+//
+// 接口中的每个方法都必须是服务端方法的形式，即 Fun1(req *Req, resp *Resp) error
+// 或者 Fun1(ctx context.Context, req *Req, resp *Resp) error
+// 服务端流式方法 Fun2(req *Req, stream gorpc.ServerStream[Resp]) error
+// 和双向流式方法 Fun3(stream gorpc.BidiStream[Req, Resp]) error 也可以在接口中声明
+// 一般通过 go:generate 使用:
+//
+//	//go:generate gorpc-gen -type Greeter -service T -impl greeter
+//	type Greeter interface {
+//		Fun1(req *Req, resp *Resp) error
+//	}
+//
+// gorpc 包可以使用别名或者点导入，流式类型按照源文件中 import 的名字识别
+//
+// 会在同一目录下生成 greeter_gorpc.go，包含:
+//   - GreeterClient: 每个方法对应一个 Fun1(ctx, *Req) (Resp, error)
+//     流式方法对应一个 Fun2(ctx, *Req) iter.Seq2[*Resp, error]，双向流式方法对应一个 Fun3(ctx) (*gorpc.Stream, error)
+//   - NewGreeterServer: 只接受实现了 Greeter 的 receiver 的 gorpc.NewServer
+//   - var _ Greeter = (*greeter)(nil): 指定 -impl 时生成，检查实现类型
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "接口名，必填")
+	service := flag.String("service", "", "服务名，默认与接口名相同")
+	impl := flag.String("impl", "", "实现接口的类型名，指定时生成编译期检查")
+	file := flag.String("file", os.Getenv("GOFILE"), "接口所在的源文件，go:generate 中默认为当前文件")
+	output := flag.String("o", "", "输出文件，默认为 <接口名小写>_gorpc.go")
+	flag.Parse()
+
+	if *typeName == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *service == "" {
+		*service = *typeName
+	}
+	if *output == "" {
+		*output = filepath.Join(filepath.Dir(*file), strings.ToLower(*typeName)+"_gorpc.go")
+	}
+
+	src, err := generate(*file, *typeName, *service, *impl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gorpc-gen: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "gorpc-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// method 接口中的一个方法
+type method struct {
+	name   string
+	req    string // 参数类型
+	resp   string // 返回值类型，即第二个参数去掉指针
+	stream bool   // 是否为服务端流式方法，此时 resp 为 ServerStream 的类型参数
+	bidi   bool   // 是否为双向流式方法，此时 req 和 resp 为 BidiStream 的类型参数，req 带有指针
+}
+
+// generate 解析源文件中的接口并生成代码
+// 参数:
+//   - file: 源文件路径
+//   - typeName: 接口名
+//   - service: 服务名
+//   - impl: 实现接口的类型名，可以为空
+//
+// 返回值:
+//   - []byte: 格式化后的代码
+//   - error: 如果发生错误，则返回错误信息。
+func generate(file, typeName, service, impl string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	iface := findInterface(f, typeName)
+	if iface == nil {
+		return nil, fmt.Errorf("interface %s not found in %s", typeName, file)
+	}
+	pkg := gorpcImportName(f)
+
+	used := map[string]bool{}
+	var methods []method
+	for _, field := range iface.Methods.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		fn := field.Type.(*ast.FuncType)
+		m, err := parseMethod(fset, field.Names[0].Name, fn, pkg, used)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, m)
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("interface %s has no methods", typeName)
+	}
+
+	var buf bytes.Buffer
+	writeFile(&buf, f, typeName, service, impl, methods, used)
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+func findInterface(f *ast.File, name string) *ast.InterfaceType {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name != name {
+				continue
+			}
+			if iface, ok := ts.Type.(*ast.InterfaceType); ok {
+				return iface
+			}
+		}
+	}
+	return nil
+}
+
+// gorpcPath gorpc 包的导入路径
+const gorpcPath = "github.com/wifi32767/HTTPGoRpc"
+
+// gorpcImportName 源文件中 gorpc 包的名字
+// 没有别名时为包名 gorpc，点导入时为 "."，没有导入时为空
+func gorpcImportName(f *ast.File) string {
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if path != gorpcPath {
+			continue
+		}
+		if spec.Name == nil {
+			return "gorpc"
+		}
+		if spec.Name.Name != "_" {
+			return spec.Name.Name
+		}
+	}
+	return ""
+}
+
+// parseMethod 检查方法的形式并取出参数和返回值类型
+// pkg 为源文件中 gorpc 包的名字，used 记录类型中用到的包名，用于生成 import
+func parseMethod(fset *token.FileSet, name string, fn *ast.FuncType, pkg string, used map[string]bool) (method, error) {
+	pos := fset.Position(fn.Pos())
+	var params []ast.Expr
+	for _, p := range fn.Params.List {
+		n := len(p.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, p.Type)
+		}
+	}
+	// 第一个参数可以是 context.Context，生成的客户端不需要它
+	if len(params) >= 2 && exprString(fset, params[0]) == "context.Context" {
+		params = params[1:]
+	}
+	if len(params) == 1 {
+		if req, resp, ok := bidiStreamElems(params[0], pkg); ok {
+			if err := checkResults(pos, name, fn); err != nil {
+				return method{}, err
+			}
+			// 生成的代码中不会出现 BidiStream 本身，只记录类型参数用到的包
+			collectPackages(req, used)
+			collectPackages(resp, used)
+			return method{
+				name: name,
+				req:  "*" + exprString(fset, req),
+				resp: exprString(fset, resp),
+				bidi: true,
+			}, nil
+		}
+	}
+	if len(params) != 2 {
+		return method{}, fmt.Errorf("%s: method %s must have exactly 2 parameters besides context.Context", pos, name)
+	}
+	if err := checkResults(pos, name, fn); err != nil {
+		return method{}, err
+	}
+	collectPackages(params[0], used)
+	if elem, ok := serverStreamElem(params[1], pkg); ok {
+		collectPackages(elem, used)
+		return method{
+			name:   name,
+			req:    exprString(fset, params[0]),
+			resp:   exprString(fset, elem),
+			stream: true,
+		}, nil
+	}
+	star, ok := params[1].(*ast.StarExpr)
+	if !ok {
+		return method{}, fmt.Errorf("%s: second parameter of method %s must be a pointer", pos, name)
+	}
+	collectPackages(star.X, used)
+	return method{
+		name: name,
+		req:  exprString(fset, params[0]),
+		resp: exprString(fset, star.X),
+	}, nil
+}
+
+// checkResults 检查方法是否只返回 error
+func checkResults(pos token.Position, name string, fn *ast.FuncType) error {
+	if fn.Results == nil || len(fn.Results.List) != 1 || len(fn.Results.List[0].Names) > 1 {
+		return fmt.Errorf("%s: method %s must return only error", pos, name)
+	}
+	if id, ok := fn.Results.List[0].Type.(*ast.Ident); !ok || id.Name != "error" {
+		return fmt.Errorf("%s: method %s must return only error", pos, name)
+	}
+	return nil
+}
+
+// bidiStreamElems 判断类型是否为 gorpc.BidiStream[Req, Resp]，是时返回 Req 和 Resp
+func bidiStreamElems(expr ast.Expr, pkg string) (ast.Expr, ast.Expr, bool) {
+	index, ok := expr.(*ast.IndexListExpr)
+	if !ok || len(index.Indices) != 2 || !isGorpcType(index.X, pkg, "BidiStream") {
+		return nil, nil, false
+	}
+	return index.Indices[0], index.Indices[1], true
+}
+
+// isGorpcType 判断表达式是否为 gorpc 包中的 name 类型
+// pkg 为源文件中 gorpc 包的名字，点导入时类型没有包名
+func isGorpcType(expr ast.Expr, pkg, name string) bool {
+	switch x := expr.(type) {
+	case *ast.SelectorExpr:
+		id, ok := x.X.(*ast.Ident)
+		return ok && pkg != "" && pkg != "." && id.Name == pkg && x.Sel.Name == name
+	case *ast.Ident:
+		return pkg == "." && x.Name == name
+	}
+	return false
+}
+
+// serverStreamElem 判断类型是否为 gorpc.ServerStream[T]，是时返回 T
+func serverStreamElem(expr ast.Expr, pkg string) (ast.Expr, bool) {
+	index, ok := expr.(*ast.IndexExpr)
+	if !ok || !isGorpcType(index.X, pkg, "ServerStream") {
+		return nil, false
+	}
+	return index.Index, true
+}
+
+// collectPackages 记录类型表达式中引用的包名
+func collectPackages(expr ast.Expr, used map[string]bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+			return false
+		}
+		return true
+	})
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// imports 源文件中被方法类型用到的 import，返回 import 语句中的内容
+// 生成的代码总是以 gorpc 为名导入 gorpc 包，参数类型通过别名引用 gorpc 包时同时保留这个别名
+func imports(f *ast.File, used map[string]bool) []string {
+	var specs []string
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if path == gorpcPath {
+			name = "gorpc"
+		}
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if !used[name] || name == "context" || name == "time" || name == "gorpc" && path == gorpcPath {
+			continue
+		}
+		if spec.Name != nil {
+			specs = append(specs, spec.Name.Name+" "+spec.Path.Value)
+		} else {
+			specs = append(specs, spec.Path.Value)
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+func writeFile(buf *bytes.Buffer, f *ast.File, typeName, service, impl string, methods []method, used map[string]bool) {
+	client := typeName + "Client"
+	fmt.Fprintf(buf, "// Code generated by gorpc-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", f.Name.Name)
+	fmt.Fprintf(buf, "import (\n\t\"context\"\n")
+	if hasStream(methods) {
+		fmt.Fprintf(buf, "\t\"iter\"\n")
+	}
+	fmt.Fprintf(buf, "\t\"time\"\n\n")
+	for _, spec := range imports(f, used) {
+		fmt.Fprintf(buf, "\t%s\n", spec)
+	}
+	fmt.Fprintf(buf, "\tgorpc \"github.com/wifi32767/HTTPGoRpc\"\n)\n\n")
+
+	fmt.Fprintf(buf, "// %sServiceName %s 对应的服务名\n", typeName, typeName)
+	fmt.Fprintf(buf, "const %sServiceName = %q\n\n", typeName, service)
+
+	fmt.Fprintf(buf, "// %s %s 的类型化客户端\n", client, typeName)
+	fmt.Fprintf(buf, "type %s struct {\n", client)
+	for _, m := range methods {
+		fmt.Fprintf(buf, "\t%s *gorpc.MethodStub[%s, %s]\n", unexport(m.name), m.req, m.resp)
+	}
+	fmt.Fprintf(buf, "}\n\n")
+
+	fmt.Fprintf(buf, "// New%s 创建 %s 的类型化客户端\n", client, typeName)
+	fmt.Fprintf(buf, "func New%s(c *gorpc.Client) *%s {\n", client, client)
+	fmt.Fprintf(buf, "\treturn &%s{\n", client)
+	for _, m := range methods {
+		fmt.Fprintf(buf, "\t\t%s: gorpc.NewMethod[%s, %s](c, %sServiceName, %q),\n", unexport(m.name), m.req, m.resp, typeName, m.name)
+	}
+	fmt.Fprintf(buf, "\t}\n}\n")
+
+	for _, m := range methods {
+		if m.stream {
+			fmt.Fprintf(buf, "\n// %s 流式调用 %s.%s，返回依次产生返回值的迭代器\n", m.name, service, m.name)
+			fmt.Fprintf(buf, "func (c *%s) %s(ctx context.Context, req %s) iter.Seq2[*%s, error] {\n", client, m.name, m.req, m.resp)
+			fmt.Fprintf(buf, "\treturn c.%s.Stream(ctx, req)\n}\n", unexport(m.name))
+			continue
+		}
+		if m.bidi {
+			fmt.Fprintf(buf, "\n// %s 打开到 %s.%s 的双向流\n", m.name, service, m.name)
+			fmt.Fprintf(buf, "func (c *%s) %s(ctx context.Context) (*gorpc.Stream, error) {\n", client, m.name)
+			fmt.Fprintf(buf, "\treturn c.%s.Open(ctx)\n}\n", unexport(m.name))
+			continue
+		}
+		fmt.Fprintf(buf, "\n// %s 同步调用 %s.%s\n", m.name, service, m.name)
+		fmt.Fprintf(buf, "func (c *%s) %s(ctx context.Context, req %s) (%s, error) {\n", client, m.name, m.req, m.resp)
+		fmt.Fprintf(buf, "\treturn c.%s.Call(ctx, req)\n}\n", unexport(m.name))
+		fmt.Fprintf(buf, "\n// %sAsync 异步调用 %s.%s\n", m.name, service, m.name)
+		fmt.Fprintf(buf, "func (c *%s) %sAsync(ctx context.Context, req %s) *gorpc.Future[%s] {\n", client, m.name, m.req, m.resp)
+		fmt.Fprintf(buf, "\treturn c.%s.Go(ctx, req)\n}\n", unexport(m.name))
+	}
+
+	fmt.Fprintf(buf, "\n// New%sServer 创建提供 %s 服务的服务端，receiver 必须实现 %s\n", typeName, service, typeName)
+	fmt.Fprintf(buf, "func New%sServer(port string, receiver %s, heartbeatTimeout time.Duration) (*gorpc.Server, error) {\n", typeName, typeName)
+	fmt.Fprintf(buf, "\treturn gorpc.NewServer(%sServiceName, port, receiver, heartbeatTimeout)\n}\n", typeName)
+
+	if impl != "" {
+		fmt.Fprintf(buf, "\n// 检查 %s 是否实现了 %s\n", impl, typeName)
+		fmt.Fprintf(buf, "var _ %s = (*%s)(nil)\n", typeName, impl)
+	}
+}
+
+// hasStream 是否有服务端流式方法
+func hasStream(methods []method) bool {
+	for _, m := range methods {
+		if m.stream {
+			return true
+		}
+	}
+	return false
+}
+
+// unexport 方法名对应的字段名，加上后缀避免与关键字冲突
+func unexport(name string) string {
+	return strings.ToLower(name[:1]) + name[1:] + "Stub"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+// 生成的代码与 testdata 中的 golden 文件对比，修改生成器后使用 go test -update 更新
+func TestGenerateGolden(t *testing.T) {
+	tests := []struct {
+		file     string
+		typeName string
+		service  string
+		impl     string
+		golden   string
+	}{
+		{"greeter.go", "Greeter", "T", "greeter", "greeter_gorpc.go.golden"},
+		{"aliased.go", "Watcher", "Watcher", "", "watcher_gorpc.go.golden"},
+		{"dot.go", "Streamer", "Streamer", "", "streamer_gorpc.go.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typeName, func(t *testing.T) {
+			got, err := generate(filepath.Join("testdata", tt.file), tt.typeName, tt.service, tt.impl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("generated code does not match %s, run go test -update to update it\ngot:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// 没有导入 gorpc 包时同名的类型不是流式类型
+func TestGenerateRequiresGorpcImport(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "local.go")
+	src := `package local
+
+type ServerStream[T any] struct{}
+
+type Local interface {
+	Watch(req *int, stream ServerStream[int]) error
+}
+`
+	if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := generate(file, "Local", "Local", ""); err == nil {
+		t.Fatal("a local ServerStream should not be treated as gorpc.ServerStream")
+	}
+}
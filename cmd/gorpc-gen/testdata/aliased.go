@@ -0,0 +1,12 @@
+package greeter
+
+import (
+	rpc "github.com/wifi32767/HTTPGoRpc"
+)
+
+// Watcher 使用别名导入 gorpc，参数类型也通过别名引用 gorpc 包
+type Watcher interface {
+	Check(req *rpc.HealthCheckRequest, resp *Resp) error
+	Watch(req *Req, stream rpc.ServerStream[Resp]) error
+	Chat(stream rpc.BidiStream[Req, Resp]) error
+}
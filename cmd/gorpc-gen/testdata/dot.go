@@ -0,0 +1,11 @@
+package greeter
+
+import (
+	. "github.com/wifi32767/HTTPGoRpc"
+)
+
+// Streamer 点导入 gorpc
+type Streamer interface {
+	Watch(req *Req, stream ServerStream[Resp]) error
+	Chat(stream BidiStream[Req, Resp]) error
+}
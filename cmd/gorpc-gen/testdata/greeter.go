@@ -0,0 +1,34 @@
+package greeter
+
+import (
+	"context"
+	"encoding/json"
+
+	gorpc "github.com/wifi32767/HTTPGoRpc"
+)
+
+//go:generate gorpc-gen -type Greeter -service T -impl greeter
+type Greeter interface {
+	Hello(req *Req, resp *Resp) error
+	HelloCtx(ctx context.Context, req *Req, resp *json.RawMessage) error
+	Watch(req *Req, stream gorpc.ServerStream[Resp]) error
+	Chat(stream gorpc.BidiStream[Req, Resp]) error
+}
+
+type Req struct {
+	Name string
+}
+
+type Resp struct {
+	Message string
+}
+
+type greeter struct{}
+
+func (g *greeter) Hello(req *Req, resp *Resp) error { return nil }
+
+func (g *greeter) HelloCtx(ctx context.Context, req *Req, resp *json.RawMessage) error { return nil }
+
+func (g *greeter) Watch(req *Req, stream gorpc.ServerStream[Resp]) error { return nil }
+
+func (g *greeter) Chat(stream gorpc.BidiStream[Req, Resp]) error { return nil }
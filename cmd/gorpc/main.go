@@ -0,0 +1,380 @@
+// gorpc 是一个命令行工具，用于临时发起调用、查看注册中心和服务端的信息，以及运行独立的注册中心
+//
+// 用法:
+//
+//	gorpc call -addr localhost:2222 T.Fun1 '{"Name":"hello","Id":1}'
+//	gorpc call -registry http://localhost:1111 T.Fun1 '{"Name":"hello","Id":1}'
+//	gorpc list -registry http://localhost:1111
+//	gorpc describe -addr localhost:2222
+//	gorpc openapi -addr localhost:2222 -o openapi.json
+//	gorpc registry -port :1111 -timeout-factor 3 -lb round_robin
+//
+// 连接使用 HTTPS 的服务端和注册中心时，使用 -ca 指定 CA，需要 mTLS 时再使用 -cert 和 -key 指定客户端证书
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	gorpc "github.com/wifi32767/HTTPGoRpc"
+	"github.com/wifi32767/HTTPGoRpc/codec"
+	"github.com/wifi32767/HTTPGoRpc/registry"
+)
+
+const usage = `usage: gorpc <command> [flags]
+
+commands:
+  call      调用一个方法，参数和返回值都使用 JSON
+  list      列出注册中心中的服务和实例
+  describe  查看服务端的内省信息
+  openapi   导出服务端的 OpenAPI 文档
+  registry  运行一个独立的注册中心
+
+使用 gorpc <command> -h 查看各个命令的参数
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "call":
+		err = runCall(os.Args[2:])
+	case "list":
+		err = runList(os.Args[2:])
+	case "describe":
+		err = runDescribe(os.Args[2:])
+	case "openapi":
+		err = runOpenAPI(os.Args[2:])
+	case "registry":
+		err = runRegistry(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "gorpc: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gorpc:", err)
+		os.Exit(1)
+	}
+}
+
+// runCall 使用 json 编解码器调用一个方法，并把返回值格式化输出
+func runCall(args []string) error {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	addr := fs.String("addr", "", "服务端地址，如 localhost:2222")
+	reg := fs.String("registry", "", "注册中心地址，如 http://localhost:1111，设置后忽略 -addr")
+	timeout := fs.Duration("timeout", 5*time.Second, "调用超时时间")
+	token := fs.String("token", "", "Bearer token，服务端开启认证时使用")
+	tf := addTLSFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gorpc call [flags] Service.Method [json]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	service, method, arg, err := parseCallArgs(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	config, err := tf.config()
+	if err != nil {
+		return err
+	}
+	opt := &gorpc.Options{CodecType: codec.TypeJson, TLSConfig: config}
+	if *token != "" {
+		opt.Credentials = gorpc.BearerToken(*token)
+	}
+	target := *addr
+	if *reg != "" {
+		opt.UseRegistry = true
+		target = *reg
+	}
+	if target == "" {
+		return fmt.Errorf("either -addr or -registry is required")
+	}
+	cli := gorpc.NewClient(target, opt)
+	if cli == nil {
+		return fmt.Errorf("create client failed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	var ret json.RawMessage
+	if err := cli.Call(ctx, service, method, arg, &ret); err != nil {
+		return err
+	}
+	return printJSON(ret)
+}
+
+// parseCallArgs 解析 call 的位置参数 Service.Method [json]
+// 没有参数时使用 {}
+func parseCallArgs(args []string) (service, method string, arg json.RawMessage, err error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", "", nil, fmt.Errorf("expected Service.Method [json], got %d arguments", len(args))
+	}
+	// 内置服务的服务名中带有 "."，以最后一个 "." 分隔
+	i := strings.LastIndex(args[0], ".")
+	if i <= 0 || i == len(args[0])-1 {
+		return "", "", nil, fmt.Errorf("invalid method %q, expected Service.Method", args[0])
+	}
+	arg = json.RawMessage("{}")
+	if len(args) == 2 {
+		arg = json.RawMessage(args[1])
+		if !json.Valid(arg) {
+			return "", "", nil, fmt.Errorf("argument is not valid json")
+		}
+	}
+	return args[0][:i], args[0][i+1:], arg, nil
+}
+
+// runList 列出注册中心中的服务实例
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	reg := fs.String("registry", "http://localhost:1111", "注册中心地址")
+	raw := fs.Bool("json", false, "以 JSON 格式输出")
+	tf := addTLSFlags(fs)
+	_ = fs.Parse(args)
+	config, err := tf.config()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", baseURL(*reg, config)+"/list", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Type", gorpc.TypeList)
+	b, err := do(config, req)
+	if err != nil {
+		return err
+	}
+	if *raw {
+		return printJSON(b)
+	}
+	var services []registry.ServiceInfo
+	if err := json.Unmarshal(b, &services); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tADDR\tSTATUS\tLAST PING")
+	for _, s := range services {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s ago\n", s.Name, s.URL(), s.Status, time.Since(s.LastPingTime).Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
+
+// runDescribe 输出服务端的内省信息
+func runDescribe(args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:2222", "服务端地址")
+	raw := fs.Bool("json", false, "以 JSON 格式输出完整信息")
+	token := fs.String("token", "", "Bearer token，服务端开启认证时使用")
+	tf := addTLSFlags(fs)
+	_ = fs.Parse(args)
+	config, err := tf.config()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", baseURL(*addr, config)+"/introspect", nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	b, err := do(config, req)
+	if err != nil {
+		return err
+	}
+	if *raw {
+		return printJSON(b)
+	}
+	var services []gorpc.ServiceDesc
+	if err := json.Unmarshal(b, &services); err != nil {
+		return err
+	}
+	for _, s := range services {
+		if s.Builtin {
+			fmt.Printf("%s (builtin)\n", s.Name)
+		} else {
+			fmt.Println(s.Name)
+		}
+		for _, m := range s.Methods {
+			fmt.Printf("  %s(%s) %s\n", m.Name, typeName(m.ArgType), typeName(m.RetType))
+			schema, err := json.Marshal(m.ArgSchema)
+			if err == nil {
+				fmt.Printf("    arg: %s\n", schema)
+			}
+		}
+	}
+	return nil
+}
+
+// runOpenAPI 导出服务端的 OpenAPI 文档
+func runOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:2222", "服务端地址")
+	out := fs.String("o", "", "输出文件，为空时输出到标准输出")
+	token := fs.String("token", "", "Bearer token，服务端开启认证时使用")
+	tf := addTLSFlags(fs)
+	_ = fs.Parse(args)
+	config, err := tf.config()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", baseURL(*addr, config)+gorpc.OpenAPIPath, nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	b, err := do(config, req)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return printJSON(b)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	return os.WriteFile(*out, buf.Bytes(), 0o644)
+}
+
+// runRegistry 运行一个独立的注册中心
+func runRegistry(args []string) error {
+	fs := flag.NewFlagSet("registry", flag.ExitOnError)
+	port := fs.String("port", ":1111", "监听端口")
+	factor := fs.Float64("timeout-factor", registry.DefaultOptions.TimeoutFactor, "心跳超时倍数，超过 心跳间隔*倍数 没有心跳的服务会被踢出")
+	lb := fs.String("lb", string(registry.TypeRoundRobin), "负载均衡类型")
+	cert := fs.String("cert", "", "证书，与 -key 一起设置时使用 HTTPS")
+	key := fs.String("key", "", "私钥")
+	clientCA := fs.String("client-ca", "", "验证服务端和客户端证书的 CA，设置后要求对方提供证书")
+	_ = fs.Parse(args)
+
+	var config *tls.Config
+	if *cert != "" {
+		var err error
+		config, err = gorpc.ServerTLSConfig(*cert, *key, *clientCA)
+		if err != nil {
+			return err
+		}
+	}
+	reg := registry.NewRegistry(*port, &registry.Options{
+		TimeoutFactor: *factor,
+		LoadBalance:   registry.Type(*lb),
+		TLSConfig:     config,
+	})
+	if reg == nil {
+		return fmt.Errorf("create registry failed")
+	}
+	return reg.Run()
+}
+
+// tlsFlags 连接 HTTPS 服务端或注册中心时使用的参数
+type tlsFlags struct {
+	ca   *string
+	cert *string
+	key  *string
+}
+
+func addTLSFlags(fs *flag.FlagSet) *tlsFlags {
+	return &tlsFlags{
+		ca:   fs.String("ca", "", "验证对方证书的 CA，设置后使用 HTTPS"),
+		cert: fs.String("cert", "", "客户端证书，对方要求 mTLS 时使用，设置后使用 HTTPS"),
+		key:  fs.String("key", "", "客户端私钥"),
+	}
+}
+
+// config 生成客户端的 TLS 配置，没有设置任何参数时返回 nil
+func (f *tlsFlags) config() (*tls.Config, error) {
+	if *f.ca == "" && *f.cert == "" {
+		return nil, nil
+	}
+	return gorpc.ClientTLSConfig(*f.ca, *f.cert, *f.key)
+}
+
+// baseURL 在没有协议的地址前加上协议
+func baseURL(addr string, config *tls.Config) string {
+	if strings.Contains(addr, "://") {
+		return addr
+	}
+	if config != nil {
+		return "https://" + addr
+	}
+	return "http://" + addr
+}
+
+// do 发送请求并读取响应体，非200的响应作为错误返回
+func do(config *tls.Config, req *http.Request) ([]byte, error) {
+	cli := http.DefaultClient
+	if config != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		cli = &http.Client{Transport: transport}
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("[%d] %s", resp.StatusCode, b)
+	}
+	return b, nil
+}
+
+func printJSON(b []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(os.Stdout)
+	return err
+}
+
+func typeName(t *gorpc.TypeDesc) string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind {
+	case "ptr":
+		return "*" + typeName(t.Elem)
+	case "slice":
+		return "[]" + typeName(t.Elem)
+	case "map":
+		return "map[" + typeName(t.Key) + "]" + typeName(t.Elem)
+	}
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Kind
+}
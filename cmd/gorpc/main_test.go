@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	gorpc "github.com/wifi32767/HTTPGoRpc"
+)
+
+func TestParseCallArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		service string
+		method  string
+		arg     string
+		wantErr bool
+	}{
+		{args: []string{"T.Fun1"}, service: "T", method: "Fun1", arg: "{}"},
+		{args: []string{"T.Fun1", `{"Name":"a"}`}, service: "T", method: "Fun1", arg: `{"Name":"a"}`},
+		{args: []string{"T.Fun1", `[1,2]`}, service: "T", method: "Fun1", arg: `[1,2]`},
+		// 内置服务的服务名中带有 "."
+		{args: []string{"gorpc.Health.Check", `{"Service":"T"}`}, service: "gorpc.Health", method: "Check", arg: `{"Service":"T"}`},
+		{args: []string{"a.b.c.D"}, service: "a.b.c", method: "D", arg: "{}"},
+		{args: []string{"Fun1"}, wantErr: true},
+		{args: []string{".Fun1"}, wantErr: true},
+		{args: []string{"T."}, wantErr: true},
+		{args: []string{"T.Fun1", `{"Name":`}, wantErr: true},
+		{args: []string{}, wantErr: true},
+		{args: []string{"T.Fun1", "{}", "{}"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		service, method, arg, err := parseCallArgs(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCallArgs(%q) should fail", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCallArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if service != tt.service || method != tt.method || string(arg) != tt.arg {
+			t.Errorf("parseCallArgs(%q) = %q, %q, %s; want %q, %q, %s", tt.args, service, method, arg, tt.service, tt.method, tt.arg)
+		}
+	}
+}
+
+type cliReq struct {
+	Name string
+	Ids  []int
+}
+
+type cliService struct{}
+
+func (cliService) Echo(req *cliReq, resp *cliReq) error {
+	*resp = *req
+	return nil
+}
+
+func TestTypeName(t *testing.T) {
+	named := &gorpc.TypeDesc{Name: "main.Req", Kind: "struct"}
+	tests := []struct {
+		desc *gorpc.TypeDesc
+		want string
+	}{
+		{nil, ""},
+		{&gorpc.TypeDesc{Name: "int", Kind: "int"}, "int"},
+		{named, "main.Req"},
+		{&gorpc.TypeDesc{Kind: "ptr", Elem: named}, "*main.Req"},
+		{&gorpc.TypeDesc{Kind: "slice", Elem: &gorpc.TypeDesc{Name: "uint8", Kind: "uint8"}}, "[]uint8"},
+		{&gorpc.TypeDesc{Kind: "map", Key: &gorpc.TypeDesc{Name: "string", Kind: "string"},
+			Elem: &gorpc.TypeDesc{Kind: "slice", Elem: &gorpc.TypeDesc{Kind: "ptr", Elem: named}}}, "map[string][]*main.Req"},
+		// 匿名结构体没有名字，使用种类
+		{&gorpc.TypeDesc{Kind: "struct"}, "struct"},
+	}
+	for _, tt := range tests {
+		if got := typeName(tt.desc); got != tt.want {
+			t.Errorf("typeName(%+v) = %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+// runCall 通过真实的服务端调用用户服务和内置服务
+func TestRunCall(t *testing.T) {
+	s, err := gorpc.NewServer("T", ":0", cliService{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Authenticator = &gorpc.BearerAuthenticator{Tokens: map[string]string{"secret": "alice"}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(ln, nil)
+	addr := ln.Addr().String()
+
+	for _, args := range [][]string{
+		{"-addr", addr, "-token", "secret", "T.Echo", `{"Name":"a","Ids":[1,2]}`},
+		{"-addr", addr, "-token", "secret", "gorpc.Health.Check", `{"Service":"T"}`},
+	} {
+		if err := runCall(args); err != nil {
+			t.Errorf("runCall(%q): %v", args, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"-addr", addr, "-token", "secret", "T.Missing"},
+		{"-addr", addr, "-token", "secret", "Echo"},
+		// 没有 token 或者 token 无效
+		{"-addr", addr, "T.Echo"},
+		{"-addr", addr, "-token", "wrong", "T.Echo"},
+		{"T.Echo"},
+	} {
+		if err := runCall(args); err == nil {
+			t.Errorf("runCall(%q) should fail", args)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package codec
+
+import (
+	"bytes"
+	"sync"
+)
+
+// 超过这个容量的缓冲区不放回池中，避免偶尔的大消息长期占用内存
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// copyBytes 复制缓冲区中的数据，返回的切片不会被之后的编码覆盖
+func copyBytes(buf *bytes.Buffer) []byte {
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	return data
+}
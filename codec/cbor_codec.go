@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// 基于 CBOR 的编解码器
+// 结构体字段优先使用 cbor 标签，没有时使用 json 标签，与 json 编解码器的字段名保持一致
+// EncMode 和 DecMode 都是并发安全的，可以被多个协程同时使用
+type CBORCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func init() {
+	RegisterCodec(TypeCBOR, NewCBORCodec)
+	RegisterMIME(TypeCBOR, "application/cbor")
+}
+
+func NewCBORCodec() Codec {
+	// 时间使用 RFC 3339 字符串，与 json 编解码器一致
+	// 选项是固定的，创建失败只可能是选项本身有误
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(fmt.Sprintf("cbor codec: create encode mode: %v", err))
+	}
+	dec, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		panic(fmt.Sprintf("cbor codec: create decode mode: %v", err))
+	}
+	return &CBORCodec{
+		enc: enc,
+		dec: dec,
+	}
+}
+
+func (c *CBORCodec) Encode(msg any) ([]byte, error) {
+	data, err := c.enc.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("cbor codec: encode: %w", err)
+	}
+	return data, nil
+}
+
+func (c *CBORCodec) EncodeString(msg any) (string, error) {
+	data, err := c.Encode(msg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *CBORCodec) Decode(data []byte, msg any) error {
+	if err := c.dec.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("cbor codec: decode: %w", err)
+	}
+	return nil
+}
+
+func (c *CBORCodec) DecodeString(data string, msg any) error {
+	return c.Decode([]byte(data), msg)
+}
+
+func (c *CBORCodec) EncodeTo(w io.Writer, msg any) error {
+	if err := c.enc.NewEncoder(w).Encode(msg); err != nil {
+		return fmt.Errorf("cbor codec: encode: %w", err)
+	}
+	return nil
+}
+
+func (c *CBORCodec) DecodeFrom(r io.Reader, msg any) error {
+	if err := c.dec.NewDecoder(r).Decode(msg); err != nil {
+		return fmt.Errorf("cbor codec: decode: %w", err)
+	}
+	return nil
+}
@@ -1,6 +1,13 @@
 package codec
 
+import (
+	"io"
+	"reflect"
+)
+
 // 编解码器，用于将消息体编码成字节流或者将字节流解码成消息体
+// 同一个编解码器会被多个协程同时使用（例如共享一个 Client 的 AsyncCall），实现必须是并发安全的
+// Encode 返回的切片归调用方所有，不能在之后的调用中被复用或修改
 type Codec interface {
 	Encode(msg any) ([]byte, error)
 	EncodeString(msg any) (string, error)
@@ -9,13 +16,30 @@ type Codec interface {
 	DecodeString(data string, msg any) error
 }
 
+// 可选接口，编解码器可以直接在 io.Reader/io.Writer 上编解码时实现
+// 服务端和客户端会优先使用它，避免把整个消息体读入内存后再解码
+// r 中只包含一条消息，DecodeFrom 应当拒绝消息之后多余的数据，解码的 msg 必须是指针类型
+type StreamCodec interface {
+	EncodeTo(w io.Writer, msg any) error
+	DecodeFrom(r io.Reader, msg any) error
+}
+
+// 可选接口，编解码器只支持特定类型的消息时实现
+// 服务端在解码请求之前会用它检查方法的参数和返回值类型，提前给出明确的错误
+type TypeChecker interface {
+	CheckType(t reflect.Type) error
+}
+
 type CodecConstructor func() Codec
 type Type string
 type CodecConstructorMap map[Type]CodecConstructor
 
 const (
-	TypeGob  Type = "gob"
-	TypeJson Type = "json"
+	TypeGob     Type = "gob"
+	TypeJson    Type = "json"
+	TypeProto   Type = "proto"
+	TypeMsgpack Type = "msgpack"
+	TypeCBOR    Type = "cbor"
 )
 
 var CodecMap = CodecConstructorMap{
@@ -0,0 +1,210 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testMsg struct {
+	Name  string
+	Id    int
+	Tags  []string
+	Attrs map[string]int
+}
+
+func newTestMsg(i int) *testMsg {
+	return &testMsg{
+		Name:  fmt.Sprintf("msg-%d", i),
+		Id:    i,
+		Tags:  []string{"a", strings.Repeat("b", i%100)},
+		Attrs: map[string]int{"i": i},
+	}
+}
+
+// 共享同一个编解码器的多个协程同时编解码，用 go test -race 检查池中的缓冲区没有被同时使用
+func TestPooledCodecConcurrent(t *testing.T) {
+	for _, typ := range []Type{TypeGob, TypeJson} {
+		t.Run(string(typ), func(t *testing.T) {
+			cc := NewCodec(typ)
+			var wg sync.WaitGroup
+			for g := 0; g < 16; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						want := newTestMsg(g*1000 + i)
+						data, err := cc.Encode(want)
+						if err != nil {
+							t.Errorf("Encode: %v", err)
+							return
+						}
+						s, err := cc.EncodeString(want)
+						if err != nil {
+							t.Errorf("EncodeString: %v", err)
+							return
+						}
+						var got, gotString testMsg
+						if err := cc.Decode(data, &got); err != nil {
+							t.Errorf("Decode: %v", err)
+							return
+						}
+						if err := cc.DecodeString(s, &gotString); err != nil {
+							t.Errorf("DecodeString: %v", err)
+							return
+						}
+						if !reflect.DeepEqual(&got, want) || !reflect.DeepEqual(&gotString, want) {
+							t.Errorf("round trip mismatch: got %+v and %+v, want %+v", got, gotString, want)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// Encode 返回的切片不能被之后的编码覆盖
+func TestPooledCodecEncodeOwnership(t *testing.T) {
+	for _, typ := range []Type{TypeGob, TypeJson} {
+		t.Run(string(typ), func(t *testing.T) {
+			cc := NewCodec(typ)
+			first, err := cc.Encode(newTestMsg(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved := append([]byte(nil), first...)
+			for i := 0; i < 10; i++ {
+				if _, err := cc.Encode(newTestMsg(100 + i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(first, saved) {
+				t.Fatalf("encoded data was overwritten by a later Encode")
+			}
+		})
+	}
+}
+
+func TestJsonTrailingData(t *testing.T) {
+	cc := NewJsonCodec()
+	sc := cc.(StreamCodec)
+	var msg testMsg
+	if err := cc.DecodeString(`{"Name":"a","Id":1}`+" \n", &msg); err != nil {
+		t.Fatalf("trailing whitespace should be accepted: %v", err)
+	}
+	// EncodeTo 输出的换行符不影响 DecodeFrom
+	var buf bytes.Buffer
+	if err := sc.EncodeTo(&buf, newTestMsg(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.DecodeFrom(&buf, &msg); err != nil || msg.Id != 1 {
+		t.Fatalf("DecodeFrom(EncodeTo) = %+v, %v", msg, err)
+	}
+	for _, data := range []string{
+		`{"Name":"a"}{"Name":"b"}`,
+		`{"Name":"a"} x`,
+		`{"Name":"a"}]`,
+	} {
+		if err := cc.DecodeString(data, &msg); err == nil {
+			t.Errorf("DecodeString(%q) should fail", data)
+		}
+		if err := sc.DecodeFrom(strings.NewReader(data), &msg); err == nil {
+			t.Errorf("DecodeFrom(%q) should fail", data)
+		}
+		// 与 Decode 的行为一致
+		if err := cc.Decode([]byte(data), &msg); err == nil {
+			t.Errorf("Decode(%q) should fail", data)
+		}
+	}
+}
+
+// 池化的编码与每次创建缓冲区的编码对比，通过 -benchmem 或 ReportAllocs 查看分配次数
+func BenchmarkGobEncode(b *testing.B) {
+	benchmarkEncode(b, NewGobCodec())
+}
+
+func BenchmarkJsonEncode(b *testing.B) {
+	benchmarkEncode(b, NewJsonCodec())
+}
+
+func BenchmarkGobEncodeUnpooled(b *testing.B) {
+	msg := newTestMsg(42)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJsonEncodeUnpooled(b *testing.B) {
+	msg := newTestMsg(42)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGobDecode(b *testing.B) {
+	benchmarkDecode(b, NewGobCodec())
+}
+
+func BenchmarkJsonDecode(b *testing.B) {
+	benchmarkDecode(b, NewJsonCodec())
+}
+
+func BenchmarkGobEncodeParallel(b *testing.B) {
+	benchmarkEncodeParallel(b, NewGobCodec())
+}
+
+func BenchmarkJsonEncodeParallel(b *testing.B) {
+	benchmarkEncodeParallel(b, NewJsonCodec())
+}
+
+func benchmarkEncode(b *testing.B, cc Codec) {
+	msg := newTestMsg(42)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := cc.Encode(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecode(b *testing.B, cc Codec) {
+	data, err := cc.Encode(newTestMsg(42))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var msg testMsg
+		if err := cc.Decode(data, &msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkEncodeParallel(b *testing.B, cc Codec) {
+	msg := newTestMsg(42)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cc.Encode(msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
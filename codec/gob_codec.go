@@ -3,45 +3,57 @@ package codec
 import (
 	"bytes"
 	"encoding/gob"
+	"io"
+	"strings"
 )
 
+// 基于 gob 的编解码器
+// 不持有状态，编码使用的缓冲区从池中获取，可以被多个协程同时使用
 type GobCodec struct {
-	buffer bytes.Buffer
-	reader *bytes.Reader
 }
 
 func NewGobCodec() Codec {
-	return &GobCodec{
-		buffer: bytes.Buffer{},
-		reader: &bytes.Reader{},
-	}
+	return &GobCodec{}
 }
 
 func (g *GobCodec) Encode(msg any) ([]byte, error) {
-	g.buffer.Reset()
-	encoder := gob.NewEncoder(&g.buffer)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	encoder := gob.NewEncoder(buf)
 	err := encoder.Encode(msg)
 	if err != nil {
 		return nil, err
 	}
-	return g.buffer.Bytes(), nil
+	return copyBytes(buf), nil
 }
 
 func (g *GobCodec) EncodeString(msg any) (string, error) {
-	data, err := g.Encode(msg)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	encoder := gob.NewEncoder(buf)
+	err := encoder.Encode(msg)
 	if err != nil {
 		return "", err
 	}
-	return string(data), nil
+	return buf.String(), nil
 }
 
 func (g *GobCodec) Decode(data []byte, msg any) error {
-	g.reader.Reset(data)
-	decoder := gob.NewDecoder(g.reader)
+	decoder := gob.NewDecoder(bytes.NewReader(data))
 	err := decoder.Decode(msg)
 	return err
 }
 
 func (g *GobCodec) DecodeString(data string, msg any) error {
-	return g.Decode([]byte(data), msg)
+	decoder := gob.NewDecoder(strings.NewReader(data))
+	err := decoder.Decode(msg)
+	return err
+}
+
+func (g *GobCodec) EncodeTo(w io.Writer, msg any) error {
+	return gob.NewEncoder(w).Encode(msg)
+}
+
+func (g *GobCodec) DecodeFrom(r io.Reader, msg any) error {
+	return gob.NewDecoder(r).Decode(msg)
 }
@@ -0,0 +1,136 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrMessageTooLarge 解码的消息超过了 SetMaxMessageSize 设置的大小
+var ErrMessageTooLarge = errors.New("gob stream: message too large")
+
+// GobStream 连接级别的 gob 编解码器
+// 与 GobCodec 每次都创建新的 Encoder 不同，它在整个连接上复用同一对 Encoder/Decoder，
+// 每种类型的描述只在第一次出现时发送，之后的消息只包含数据本身
+// 两端必须按照相同的顺序读写，不是并发安全的，由调用方保证同一时间只有一个调用在使用
+type GobStream struct {
+	w   *bufio.Writer
+	r   *gobLimitReader
+	enc *gob.Encoder
+	dec *gob.Decoder
+}
+
+// NewGobStream 在 r 和 w 上创建一个 GobStream
+// 一般 r 和 w 是同一个连接，r 可以是已经缓冲了部分数据的 bufio.Reader
+func NewGobStream(r io.Reader, w io.Writer) *GobStream {
+	bw := bufio.NewWriter(w)
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	lr := &gobLimitReader{r: br}
+	return &GobStream{
+		w:   bw,
+		r:   lr,
+		enc: gob.NewEncoder(bw),
+		dec: gob.NewDecoder(lr),
+	}
+}
+
+// SetMaxMessageSize 限制每次 Decode 读取的字节数，包括第一次出现的类型描述，为0时不限制
+// 超过限制时 Decode 返回 ErrMessageTooLarge，之后流已经无法继续使用
+func (g *GobStream) SetMaxMessageSize(n int64) {
+	g.r.limit = n
+}
+
+// Encode 编码一条消息，消息不会立刻发送，需要调用 Flush
+func (g *GobStream) Encode(msg any) error {
+	return g.enc.Encode(msg)
+}
+
+// Flush 将已经编码的消息发送出去
+func (g *GobStream) Flush() error {
+	return g.w.Flush()
+}
+
+// Decode 解码一条消息，msg 为 nil 时丢弃这条消息
+func (g *GobStream) Decode(msg any) error {
+	g.r.remaining = g.r.limit
+	return g.dec.Decode(msg)
+}
+
+// gobLimitReader 限制一次 Decode 读取的字节数
+// gob 的每条消息以长度开头，gob.Decoder 读到长度后会先分配整条消息的缓冲区，
+// 所以在交出长度之前就检查它，而不是等读取了过多的数据之后
+// 实现 io.ByteReader，gob.Decoder 不会再包一层缓冲，读取的字节数是准确的
+type gobLimitReader struct {
+	r         *bufio.Reader
+	limit     int64 // 为0时不限制
+	remaining int64 // 这次 Decode 还可以读取的字节数
+	left      int64 // 当前消息还没有读取的字节数，包括长度，为0时下一个字节是新消息的开始
+}
+
+// next 在新消息开始时读取长度并检查限制
+func (l *gobLimitReader) next() error {
+	if l.limit <= 0 || l.left > 0 {
+		return nil
+	}
+	b, err := l.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	// gob 的无符号整数: 小于128时就是这个字节，否则这个字节是后面大端序字节数的相反数
+	prefix, count := int64(1), uint64(b[0])
+	if b[0] >= 0x80 {
+		n := int(-int8(b[0]))
+		if n > 8 {
+			return fmt.Errorf("gob stream: invalid message length prefix")
+		}
+		b, err = l.r.Peek(1 + n)
+		if err != nil {
+			return err
+		}
+		count = 0
+		for _, c := range b[1:] {
+			count = count<<8 | uint64(c)
+		}
+		prefix += int64(n)
+	}
+	if l.remaining < prefix || count > uint64(l.remaining-prefix) {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrMessageTooLarge, count, l.limit)
+	}
+	l.left = prefix + int64(count)
+	l.remaining -= l.left
+	return nil
+}
+
+func (l *gobLimitReader) Read(p []byte) (int, error) {
+	if l.limit <= 0 {
+		return l.r.Read(p)
+	}
+	if err := l.next(); err != nil {
+		return 0, err
+	}
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	return n, err
+}
+
+func (l *gobLimitReader) ReadByte() (byte, error) {
+	if l.limit <= 0 {
+		return l.r.ReadByte()
+	}
+	if err := l.next(); err != nil {
+		return 0, err
+	}
+	b, err := l.r.ReadByte()
+	if err == nil {
+		l.left--
+	}
+	return b, err
+}
@@ -0,0 +1,64 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGobStreamMaxMessageSize(t *testing.T) {
+	var wire bytes.Buffer
+	enc := NewGobStream(&bytes.Buffer{}, &wire)
+	small := testMsg{Name: "small"}
+	big := testMsg{Name: strings.Repeat("x", 4096)}
+	for _, msg := range []*testMsg{&small, &small, &big, &small} {
+		if err := enc.Encode(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewGobStream(&wire, &bytes.Buffer{})
+	dec.SetMaxMessageSize(1024)
+	// 第一条消息带有类型描述，也在限制之内
+	for i := 0; i < 2; i++ {
+		var got testMsg
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if got.Name != "small" {
+			t.Fatalf("message %d: got %q", i, got.Name)
+		}
+	}
+	var got testMsg
+	if err := dec.Decode(&got); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestGobStreamUnlimited(t *testing.T) {
+	var wire bytes.Buffer
+	enc := NewGobStream(&bytes.Buffer{}, &wire)
+	want := testMsg{Name: strings.Repeat("x", 1<<16), Tags: []string{"a"}}
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(&want); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewGobStream(&wire, &bytes.Buffer{})
+	for i := 0; i < 3; i++ {
+		var got testMsg
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != want.Name {
+			t.Fatalf("message %d mismatch", i)
+		}
+	}
+}
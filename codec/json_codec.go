@@ -1,10 +1,15 @@
 package codec
 
 import (
+	"bytes"
 	"encoding/json"
-	"log/slog"
+	"errors"
+	"io"
+	"strings"
 )
 
+// 基于 json 的编解码器
+// 不持有状态，编码使用的缓冲区从池中获取，可以被多个协程同时使用
 type JsonCodec struct {
 }
 
@@ -12,30 +17,57 @@ func NewJsonCodec() Codec {
 	return &JsonCodec{}
 }
 
+// encode 将 msg 编码到缓冲区中，去掉 json.Encoder 附加的换行符
+func (c *JsonCodec) encode(buf *bytes.Buffer, msg any) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(msg); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
 func (c *JsonCodec) Encode(msg any) ([]byte, error) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		slog.Error("json codec:", "json encode error", err)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := c.encode(buf, msg); err != nil {
+		return nil, err
 	}
-	return data, err
+	return copyBytes(buf), nil
 }
 
 func (c *JsonCodec) EncodeString(msg any) (string, error) {
-	data, err := c.Encode(msg)
-	if err != nil {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := c.encode(buf, msg); err != nil {
 		return "", err
 	}
-	return string(data), nil
+	return buf.String(), nil
 }
 
 func (c *JsonCodec) Decode(data []byte, msg any) error {
-	err := json.Unmarshal(data, msg)
-	if err != nil {
-		slog.Error("json codec:", "json decode error", err)
-	}
-	return err
+	return json.Unmarshal(data, msg)
 }
 
 func (c *JsonCodec) DecodeString(data string, msg any) error {
-	return c.Decode([]byte(data), msg)
+	return c.DecodeFrom(strings.NewReader(data), msg)
+}
+
+func (c *JsonCodec) EncodeTo(w io.Writer, msg any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(msg)
+}
+
+func (c *JsonCodec) DecodeFrom(r io.Reader, msg any) error {
+	decoder := json.NewDecoder(r)
+	if err := decoder.Decode(msg); err != nil {
+		return err
+	}
+	// 与 json.Unmarshal 一致，一个值之后除空白外不能再有其他数据
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("json codec: unexpected data after top-level value")
+	}
+	return nil
 }
@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 编解码器类型与 MIME 类型的对应关系，用于 HTTP 的 Content-Type 和 Accept
+var MIMEMap = map[Type]string{
+	TypeGob:  "application/x-gob",
+	TypeJson: "application/json",
+}
+
+// 额外接受的 MIME 类型别名
+var mimeAliases = map[string]Type{}
+
+// RegisterMIME 注册编解码器对应的 MIME 类型
+// 同一个编解码器注册多次时，第一次注册的作为发送时使用的类型，之后的作为别名
+func RegisterMIME(t Type, mimeType string) {
+	if _, ok := MIMEMap[t]; ok {
+		mimeAliases[mimeType] = t
+		return
+	}
+	MIMEMap[t] = mimeType
+}
+
+// MIMEType 获取编解码器对应的 MIME 类型
+// 没有注册过的编解码器使用 application/x-gorpc-<type>
+func MIMEType(t Type) string {
+	if m, ok := MIMEMap[t]; ok {
+		return m
+	}
+	return "application/x-gorpc-" + string(t)
+}
+
+// TypeFromMIME 根据 MIME 类型获取编解码器类型，会忽略 charset 等参数
+func TypeFromMIME(mimeType string) (Type, bool) {
+	m, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return "", false
+	}
+	for t, v := range MIMEMap {
+		if v == m {
+			return t, true
+		}
+	}
+	if t, ok := mimeAliases[m]; ok {
+		return t, true
+	}
+	if t, ok := strings.CutPrefix(m, "application/x-gorpc-"); ok {
+		return Type(t), true
+	}
+	return "", false
+}
+
+// ParseAccept 解析 Accept 头，按照 q 值从高到低返回 MIME 类型，q 值相同时保持原有顺序
+// q=0 的类型会被去掉
+func ParseAccept(accept string) []string {
+	type item struct {
+		mime string
+		q    float64
+	}
+	var items []item
+	for _, part := range strings.Split(accept, ",") {
+		m, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		items = append(items, item{m, q})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	res := make([]string, len(items))
+	for i, it := range items {
+		res[i] = it.mime
+	}
+	return res
+}
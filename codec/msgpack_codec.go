@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// 基于 MessagePack 的编解码器
+// 结构体字段优先使用 msgpack 标签，没有时使用 json 标签，与 json 编解码器的字段名保持一致
+// 不持有状态，可以被多个协程同时使用
+type MsgpackCodec struct {
+}
+
+func init() {
+	RegisterCodec(TypeMsgpack, NewMsgpackCodec)
+	RegisterMIME(TypeMsgpack, "application/msgpack")
+	RegisterMIME(TypeMsgpack, "application/x-msgpack")
+}
+
+func NewMsgpackCodec() Codec {
+	return &MsgpackCodec{}
+}
+
+func (c *MsgpackCodec) Encode(msg any) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	encoder := msgpack.NewEncoder(buf)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(msg); err != nil {
+		return nil, fmt.Errorf("msgpack codec: encode: %w", err)
+	}
+	return copyBytes(buf), nil
+}
+
+func (c *MsgpackCodec) EncodeString(msg any) (string, error) {
+	data, err := c.Encode(msg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *MsgpackCodec) Decode(data []byte, msg any) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	if err := decoder.Decode(msg); err != nil {
+		return fmt.Errorf("msgpack codec: decode: %w", err)
+	}
+	return nil
+}
+
+func (c *MsgpackCodec) DecodeString(data string, msg any) error {
+	return c.Decode([]byte(data), msg)
+}
+
+func (c *MsgpackCodec) EncodeTo(w io.Writer, msg any) error {
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(msg); err != nil {
+		return fmt.Errorf("msgpack codec: encode: %w", err)
+	}
+	return nil
+}
+
+func (c *MsgpackCodec) DecodeFrom(r io.Reader, msg any) error {
+	decoder := msgpack.NewDecoder(r)
+	decoder.SetCustomStructTag("json")
+	if err := decoder.Decode(msg); err != nil {
+		return fmt.Errorf("msgpack codec: decode: %w", err)
+	}
+	return nil
+}
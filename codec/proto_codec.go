@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 基于 Protocol Buffers 的编解码器
+// 编解码的消息必须实现 proto.Message，一般是 protoc 生成的结构体指针
+// 不持有状态，可以被多个协程同时使用
+type ProtoCodec struct {
+}
+
+func init() {
+	RegisterCodec(TypeProto, NewProtoCodec)
+	RegisterMIME(TypeProto, "application/x-protobuf")
+	RegisterMIME(TypeProto, "application/protobuf")
+}
+
+func NewProtoCodec() Codec {
+	return &ProtoCodec{}
+}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+func (c *ProtoCodec) Encode(msg any) ([]byte, error) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("proto codec: %T is not a proto.Message", msg)
+	}
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("proto codec: encode: %w", err)
+	}
+	return data, nil
+}
+
+func (c *ProtoCodec) EncodeString(msg any) (string, error) {
+	data, err := c.Encode(msg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *ProtoCodec) Decode(data []byte, msg any) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return fmt.Errorf("proto codec: %T is not a proto.Message", msg)
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("proto codec: decode: %w", err)
+	}
+	return nil
+}
+
+func (c *ProtoCodec) DecodeString(data string, msg any) error {
+	return c.Decode([]byte(data), msg)
+}
+
+// CheckType 检查类型是否实现了 proto.Message
+func (c *ProtoCodec) CheckType(t reflect.Type) error {
+	if !t.Implements(protoMessageType) {
+		return fmt.Errorf("proto codec: %s is not a proto.Message", t)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	st, err := structpb.NewStruct(map[string]any{"name": "a", "n": 1.5, "list": []any{"x", true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		in   proto.Message
+		out  proto.Message
+	}{
+		{"string", wrapperspb.String("hello"), &wrapperspb.StringValue{}},
+		{"empty string", wrapperspb.String(""), &wrapperspb.StringValue{}},
+		{"int64", wrapperspb.Int64(-1 << 40), &wrapperspb.Int64Value{}},
+		{"bytes", wrapperspb.Bytes([]byte{0, 1, 255}), &wrapperspb.BytesValue{}},
+		{"timestamp", timestamppb.New(time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)), &timestamppb.Timestamp{}},
+		{"struct", st, &structpb.Struct{}},
+	}
+	cc := NewCodec(TypeProto)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := cc.Encode(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cc.Decode(data, tt.out); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(tt.in, tt.out) {
+				t.Fatalf("got %v, want %v", tt.out, tt.in)
+			}
+			s, err := cc.EncodeString(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := tt.out.ProtoReflect().New().Interface()
+			if err := cc.DecodeString(s, out); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(tt.in, out) {
+				t.Fatalf("DecodeString got %v, want %v", out, tt.in)
+			}
+		})
+	}
+}
+
+func TestProtoRejectsNonProtoMessages(t *testing.T) {
+	cc := NewCodec(TypeProto)
+	if _, err := cc.Encode(&testMsg{Name: "a"}); err == nil {
+		t.Error("Encode of a non-proto.Message should fail")
+	}
+	if err := cc.Decode([]byte{}, &testMsg{}); err == nil {
+		t.Error("Decode into a non-proto.Message should fail")
+	}
+	if err := cc.Decode([]byte{0xff, 0xff}, &wrapperspb.StringValue{}); err == nil {
+		t.Error("Decode of invalid data should fail")
+	}
+
+	tc, ok := cc.(TypeChecker)
+	if !ok {
+		t.Fatal("proto codec should implement TypeChecker")
+	}
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(&wrapperspb.StringValue{}),
+		reflect.TypeOf(&structpb.Struct{}),
+	} {
+		if err := tc.CheckType(typ); err != nil {
+			t.Errorf("CheckType(%s): %v", typ, err)
+		}
+	}
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(&testMsg{}),
+		reflect.TypeOf(testMsg{}),
+		// 值类型没有实现 proto.Message
+		reflect.TypeOf(wrapperspb.StringValue{}),
+		reflect.TypeOf(0),
+	} {
+		if err := tc.CheckType(typ); err == nil {
+			t.Errorf("CheckType(%s) should fail", typ)
+		}
+	}
+}
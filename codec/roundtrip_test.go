@@ -0,0 +1,143 @@
+package codec
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type plainInner struct {
+	X int
+	Y []byte
+}
+
+type plainMsg struct {
+	Name   string
+	Id     int64
+	Score  float64
+	Ok     bool
+	Tags   []string
+	Attrs  map[string]int
+	Inner  plainInner
+	Ptr    *plainInner
+	Inners []plainInner
+	When   time.Time
+}
+
+type taggedInner struct {
+	Value string `json:"value"`
+}
+
+// 使用 json 标签的结构体，msgpack 和 cbor 编解码器应当使用与 json 相同的字段名
+type taggedMsg struct {
+	UserName string            `json:"user_name"`
+	Age      int               `json:"age,omitempty"`
+	Secret   string            `json:"-"`
+	Inner    taggedInner       `json:"inner"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	NoTag    int
+}
+
+var allCodecs = []Type{TypeGob, TypeJson, TypeMsgpack, TypeCBOR}
+
+// roundTrip 用编解码器编码再解码 in，结果写入 out
+func roundTrip(t *testing.T, typ Type, in, out any) {
+	t.Helper()
+	cc := NewCodec(typ)
+	if cc == nil {
+		t.Fatalf("codec %s is not registered", typ)
+	}
+	data, err := cc.Encode(in)
+	if err != nil {
+		t.Fatalf("%s: Encode: %v", typ, err)
+	}
+	if err := cc.Decode(data, out); err != nil {
+		t.Fatalf("%s: Decode: %v", typ, err)
+	}
+}
+
+// normalizeTime 不同编解码器还原出的时区表示不同，统一为 UTC 后再比较
+func normalizeTime(m *plainMsg) {
+	m.When = m.When.UTC()
+}
+
+func TestRoundTripMatchesGobAndJson(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  plainMsg
+	}{
+		{"zero", plainMsg{}},
+		{"scalars", plainMsg{Name: "hello", Id: -1 << 40, Score: 3.5, Ok: true}},
+		{"collections", plainMsg{
+			Tags:   []string{"a", "b", ""},
+			Attrs:  map[string]int{"x": 1, "y": -2},
+			Inners: []plainInner{{X: 1}, {X: 2, Y: []byte{0, 1, 255}}},
+		}},
+		{"nested", plainMsg{
+			Inner: plainInner{X: 7, Y: []byte("bytes")},
+			Ptr:   &plainInner{X: 8},
+		}},
+		{"time", plainMsg{When: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromGob, fromJson plainMsg
+			roundTrip(t, TypeGob, &tt.msg, &fromGob)
+			roundTrip(t, TypeJson, &tt.msg, &fromJson)
+			normalizeTime(&fromGob)
+			normalizeTime(&fromJson)
+			for _, typ := range allCodecs {
+				var got plainMsg
+				roundTrip(t, typ, &tt.msg, &got)
+				normalizeTime(&got)
+				if !reflect.DeepEqual(got, fromGob) && !reflect.DeepEqual(got, fromJson) {
+					t.Errorf("%s: got %+v\ngob:  %+v\njson: %+v", typ, got, fromGob, fromJson)
+				}
+				if typ != TypeGob && !reflect.DeepEqual(got, fromJson) {
+					t.Errorf("%s: got %+v, json got %+v", typ, got, fromJson)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTripJsonTags(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  taggedMsg
+	}{
+		{"full", taggedMsg{UserName: "u", Age: 3, Secret: "s", Inner: taggedInner{Value: "v"}, Labels: map[string]string{"k": "v"}, NoTag: 1}},
+		{"omitempty", taggedMsg{UserName: "u", Secret: "s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromJson taggedMsg
+			roundTrip(t, TypeJson, &tt.msg, &fromJson)
+			wantKeys := encodedKeys(t, TypeJson, &tt.msg)
+			for _, typ := range []Type{TypeMsgpack, TypeCBOR} {
+				var got taggedMsg
+				roundTrip(t, typ, &tt.msg, &got)
+				if !reflect.DeepEqual(got, fromJson) {
+					t.Errorf("%s: got %+v, json got %+v", typ, got, fromJson)
+				}
+				if keys := encodedKeys(t, typ, &tt.msg); !reflect.DeepEqual(keys, wantKeys) {
+					t.Errorf("%s: encoded keys %v, json encoded keys %v", typ, keys, wantKeys)
+				}
+			}
+		})
+	}
+}
+
+// encodedKeys 把编码结果解码成 map，返回排序后的字段名
+func encodedKeys(t *testing.T, typ Type, msg any) []string {
+	t.Helper()
+	var m map[string]any
+	roundTrip(t, typ, msg, &m)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 压缩器，用于压缩和解压消息体
+// 压缩器的类型就是 HTTP 的 Content-Encoding，会被多个协程同时使用，实现必须是并发安全的
+type Compressor interface {
+	// NewWriter 返回一个压缩写入器，写入的数据压缩后写入 w，Close 时写入剩余的数据
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader 返回一个解压读取器，从 r 中读取压缩的数据
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type Type string
+type CompressorMap map[Type]Compressor
+
+const (
+	TypeGzip    Type = "gzip"
+	TypeDeflate Type = "deflate"
+	TypeZstd    Type = "zstd"
+	TypeSnappy  Type = "snappy"
+)
+
+var Compressors = CompressorMap{
+	TypeGzip:    &Gzip{},
+	TypeDeflate: &Deflate{},
+}
+
+// 自定义压缩器
+// Compressors 没有加锁，只能在 init 中或者开始处理请求之前注册
+func RegisterCompressor(t Type, c Compressor) {
+	Compressors[t] = c
+}
+
+func GetCompressor(t Type) Compressor {
+	if c, ok := Compressors[t]; ok {
+		return c
+	}
+	return nil
+}
+
+// ParseAcceptEncoding 解析 Accept-Encoding 头，返回已经注册的压缩器类型
+// 按照 q 值从高到低排列，q 值相同时保持原有顺序，identity 和 q=0 的类型会被去掉
+func ParseAcceptEncoding(accept string) []Type {
+	type item struct {
+		t Type
+		q float64
+	}
+	var items []item
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if _, ok := Compressors[Type(name)]; !ok {
+			continue
+		}
+		items = append(items, item{Type(name), q})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	res := make([]Type, len(items))
+	for i, it := range items {
+		res[i] = it.t
+	}
+	return res
+}
+
+// Compress 使用压缩器压缩一段数据
+func Compress(c Compressor, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
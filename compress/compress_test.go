@@ -0,0 +1,88 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   []Type
+	}{
+		{"", []Type{}},
+		{"gzip", []Type{TypeGzip}},
+		{"GZIP", []Type{TypeGzip}},
+		// q 值从高到低
+		{"gzip;q=0.5, zstd", []Type{TypeZstd, TypeGzip}},
+		{"deflate;q=0.2, snappy;q=0.8, gzip;q=0.5", []Type{TypeSnappy, TypeGzip, TypeDeflate}},
+		// q 值相同时保持原有顺序
+		{"zstd, gzip, deflate", []Type{TypeZstd, TypeGzip, TypeDeflate}},
+		{"gzip;q=0.5, deflate;q=0.5", []Type{TypeGzip, TypeDeflate}},
+		// q=0 表示不接受
+		{"gzip;q=0, deflate", []Type{TypeDeflate}},
+		{"gzip;q=0.0", []Type{}},
+		// identity、* 和没有注册的压缩器被去掉
+		{"identity, br, gzip", []Type{TypeGzip}},
+		{"*", []Type{}},
+		// 无法解析的 q 值按 1 处理
+		{"deflate;q=0.5, gzip;q=x", []Type{TypeGzip, TypeDeflate}},
+		{" gzip ; q=0.3 ,zstd ; q=0.4", []Type{TypeZstd, TypeGzip}},
+	}
+	for _, tt := range tests {
+		got := ParseAcceptEncoding(tt.accept)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseAcceptEncoding(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte(strings.Repeat("hello gorpc ", 10000)),
+	}
+	for typ, c := range Compressors {
+		t.Run(string(typ), func(t *testing.T) {
+			// 重复使用以覆盖池中复用的写入器
+			for range 2 {
+				for _, in := range inputs {
+					compressed, err := Compress(c, in)
+					if err != nil {
+						t.Fatalf("Compress: %v", err)
+					}
+					if len(in) > 1024 && len(compressed) >= len(in) {
+						t.Errorf("compressed %d bytes to %d", len(in), len(compressed))
+					}
+					r, err := c.NewReader(bytes.NewReader(compressed))
+					if err != nil {
+						t.Fatalf("NewReader: %v", err)
+					}
+					out, err := io.ReadAll(r)
+					r.Close()
+					if err != nil {
+						t.Fatalf("decompress: %v", err)
+					}
+					if !bytes.Equal(out, in) {
+						t.Fatalf("round trip mismatch: got %d bytes, want %d", len(out), len(in))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetCompressor(t *testing.T) {
+	for _, typ := range []Type{TypeGzip, TypeDeflate, TypeZstd, TypeSnappy} {
+		if GetCompressor(typ) == nil {
+			t.Errorf("GetCompressor(%s) = nil", typ)
+		}
+	}
+	if GetCompressor("br") != nil {
+		t.Error("GetCompressor(br) should be nil")
+	}
+}
@@ -0,0 +1,56 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// 基于 compress/gzip 的压缩器，压缩写入器会被复用
+type Gzip struct {
+	pool sync.Pool
+}
+
+func (g *Gzip) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if zw, ok := g.pool.Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return &pooledWriter{WriteCloser: zw, put: func() { g.pool.Put(zw) }}, nil
+	}
+	zw := gzip.NewWriter(w)
+	return &pooledWriter{WriteCloser: zw, put: func() { g.pool.Put(zw) }}, nil
+}
+
+func (g *Gzip) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// HTTP 中的 deflate 编码实际上是 zlib 格式
+type Deflate struct {
+	pool sync.Pool
+}
+
+func (d *Deflate) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if zw, ok := d.pool.Get().(*zlib.Writer); ok {
+		zw.Reset(w)
+		return &pooledWriter{WriteCloser: zw, put: func() { d.pool.Put(zw) }}, nil
+	}
+	zw := zlib.NewWriter(w)
+	return &pooledWriter{WriteCloser: zw, put: func() { d.pool.Put(zw) }}, nil
+}
+
+func (d *Deflate) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+// pooledWriter 关闭时把压缩写入器放回池中
+type pooledWriter struct {
+	io.WriteCloser
+	put func()
+}
+
+func (p *pooledWriter) Close() error {
+	err := p.WriteCloser.Close()
+	p.put()
+	return err
+}
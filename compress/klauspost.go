@@ -0,0 +1,42 @@
+package compress
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstd 和 snappy 使用 github.com/klauspost/compress 中的纯Go实现
+
+func init() {
+	RegisterCompressor(TypeZstd, &Zstd{})
+	RegisterCompressor(TypeSnappy, &Snappy{})
+}
+
+type Zstd struct {
+}
+
+func (z *Zstd) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+}
+
+func (z *Zstd) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// 使用 snappy 的流格式
+type Snappy struct {
+}
+
+func (s *Snappy) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (s *Snappy) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(snappy.NewReader(r)), nil
+}
@@ -0,0 +1,265 @@
+package gorpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// 并发限制
+// 限制同时执行的调用数，超过限制的调用进入有界的等待队列，队列满时立即返回 CodeUnavailable，
+// 等待超过 QueueTimeout 时返回 CodeResourceExhausted
+// 可以同时限制整个服务和单个方法，整个服务的限制还可以根据观察到的延迟自适应调整（AIMD）
+// 服务端流式和双向流式调用在整个流的期间占用许可，但流的持续时间不参与自适应调整
+
+// ConcurrencyOptions 并发限制设置
+type ConcurrencyOptions struct {
+	// 整个服务同时执行的最大调用数，为0时不限制，开启自适应时作为初始值
+	MaxInFlight int
+	// 每个方法同时执行的最大调用数，键为 "Service.Method"
+	Methods map[string]int
+	// 每个限制的等待队列长度，为0时超过限制的调用直接被拒绝
+	MaxQueue int
+	// 在队列中等待的最长时间，为0时一直等到调用的上下文结束
+	QueueTimeout time.Duration
+	// 不为 nil 时根据延迟自适应调整整个服务的限制
+	Adaptive *AdaptiveOptions
+}
+
+// AdaptiveOptions 自适应并发限制的参数
+// 调用延迟超过 TargetLatency 时限制乘以 Backoff，否则在限制被占满时每完成一轮调用限制加一
+type AdaptiveOptions struct {
+	MinLimit      int           // 限制的下限，为0时为1
+	MaxLimit      int           // 限制的上限，为0时不限制
+	TargetLatency time.Duration // 目标延迟
+	Backoff       float64       // 乘性减小的系数，为0时使用0.9
+}
+
+// ConcurrencyLimiter 服务端的并发限制器，可以被多个协程同时使用
+type ConcurrencyLimiter struct {
+	opt      ConcurrencyOptions
+	global   *semaphore
+	methods  map[string]*semaphore
+	adaptive *adaptiveLimit
+}
+
+// NewConcurrencyLimiter 创建并发限制器
+func NewConcurrencyLimiter(opt ConcurrencyOptions) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		opt:     opt,
+		methods: make(map[string]*semaphore),
+	}
+	if opt.MaxInFlight > 0 {
+		l.global = newSemaphore(opt.MaxInFlight, opt.MaxQueue)
+		if opt.Adaptive != nil {
+			l.adaptive = newAdaptiveLimit(*opt.Adaptive, opt.MaxInFlight)
+		}
+	}
+	for name, n := range opt.Methods {
+		if n > 0 {
+			l.methods[name] = newSemaphore(n, opt.MaxQueue)
+		}
+	}
+	return l
+}
+
+var errQueueFull = errors.New("queue is full")
+
+// Acquire 获取执行一次调用的许可，调用结束后必须调用返回的 release 并传入调用的延迟
+// 延迟小于0时只释放许可，不参与自适应调整，用于持续时间不代表服务延迟的流式调用
+// 先获取方法的许可，再获取整个服务的许可，避免占着服务的许可等待方法的许可
+// 参数:
+//   - ctx: 调用的上下文，结束时停止等待
+//   - service: 服务名
+//   - method: 方法名
+//
+// 返回值:
+//   - func(time.Duration): 释放许可
+//   - error: 被拒绝时返回 CodeUnavailable 或 CodeResourceExhausted 错误
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, service, method string) (func(time.Duration), error) {
+	queueCtx := ctx
+	if l.opt.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		queueCtx, cancel = context.WithTimeout(ctx, l.opt.QueueTimeout)
+		defer cancel()
+	}
+	name := service + "." + method
+	m := l.methods[name]
+	if m != nil {
+		if err := m.acquire(queueCtx); err != nil {
+			return nil, rejectErr(ctx, name, err)
+		}
+	}
+	if l.global != nil {
+		if err := l.global.acquire(queueCtx); err != nil {
+			if m != nil {
+				m.release()
+			}
+			return nil, rejectErr(ctx, name, err)
+		}
+	}
+	return func(latency time.Duration) {
+		if l.global != nil {
+			if l.adaptive != nil && latency >= 0 {
+				l.global.releaseAndResize(func(inflight, limit, queued int) int {
+					return l.adaptive.observe(latency, inflight >= limit || queued > 0)
+				})
+			} else {
+				l.global.release()
+			}
+		}
+		if m != nil {
+			m.release()
+		}
+	}, nil
+}
+
+// Limit 整个服务当前的并发限制，不限制时为0
+func (l *ConcurrencyLimiter) Limit() int {
+	if l.global == nil {
+		return 0
+	}
+	limit, _, _ := l.global.stats()
+	return limit
+}
+
+// InFlight 整个服务正在执行的调用数和排队的调用数，不限制时都为0
+func (l *ConcurrencyLimiter) InFlight() (inflight, queued int) {
+	if l.global == nil {
+		return 0, 0
+	}
+	_, inflight, queued = l.global.stats()
+	return inflight, queued
+}
+
+// rejectErr 获取许可失败时返回给调用方的错误
+// ctx 为调用的上下文，它没有结束时说明是等待超过了 QueueTimeout
+func rejectErr(ctx context.Context, name string, err error) error {
+	if errors.Is(err, errQueueFull) {
+		return Errorf(CodeUnavailable, "rpc server: too many concurrent calls to %s", name)
+	}
+	if ctx.Err() == nil {
+		return Errorf(CodeResourceExhausted, "rpc server: timed out waiting to call %s", name)
+	}
+	return Errorf(CodeUnavailable, "rpc server: gave up waiting to call %s: %v", name, err)
+}
+
+// semaphore 带有有界等待队列的计数信号量，等待的调用按先后顺序获得许可
+type semaphore struct {
+	mutex    sync.Mutex
+	limit    int
+	inflight int
+	maxQueue int
+	queue    []chan struct{}
+}
+
+func newSemaphore(limit, maxQueue int) *semaphore {
+	return &semaphore{limit: limit, maxQueue: maxQueue}
+}
+
+func (s *semaphore) acquire(ctx context.Context) error {
+	s.mutex.Lock()
+	if s.inflight < s.limit && len(s.queue) == 0 {
+		s.inflight++
+		s.mutex.Unlock()
+		return nil
+	}
+	if len(s.queue) >= s.maxQueue {
+		s.mutex.Unlock()
+		return errQueueFull
+	}
+	ch := make(chan struct{})
+	s.queue = append(s.queue, ch)
+	s.mutex.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-ch:
+		// 在取消的同时获得了许可，还回去
+		s.inflight--
+		s.dispatch()
+	default:
+		for i, c := range s.queue {
+			if c == ch {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *semaphore) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inflight--
+	s.dispatch()
+}
+
+// releaseAndResize 释放许可，并根据释放之前的状态调整限制
+func (s *semaphore) releaseAndResize(resize func(inflight, limit, queued int) int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.limit = resize(s.inflight, s.limit, len(s.queue))
+	s.inflight--
+	s.dispatch()
+}
+
+// dispatch 在有空余许可时唤醒等待的调用，需要持有锁
+func (s *semaphore) dispatch() {
+	for s.inflight < s.limit && len(s.queue) > 0 {
+		close(s.queue[0])
+		s.queue = s.queue[1:]
+		s.inflight++
+	}
+}
+
+func (s *semaphore) stats() (limit, inflight, queued int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.limit, s.inflight, len(s.queue)
+}
+
+// adaptiveLimit AIMD 调整的并发限制，只在信号量的锁内使用
+type adaptiveLimit struct {
+	opt          AdaptiveOptions
+	limit        float64
+	lastDecrease time.Time
+}
+
+func newAdaptiveLimit(opt AdaptiveOptions, initial int) *adaptiveLimit {
+	if opt.MinLimit <= 0 {
+		opt.MinLimit = 1
+	}
+	if opt.Backoff <= 0 || opt.Backoff >= 1 {
+		opt.Backoff = 0.9
+	}
+	return &adaptiveLimit{opt: opt, limit: float64(initial)}
+}
+
+// observe 根据一次调用的延迟调整限制，返回新的限制
+// saturated 表示调用结束时限制是否被占满，没有占满时不需要增加限制
+func (a *adaptiveLimit) observe(latency time.Duration, saturated bool) int {
+	now := time.Now()
+	if latency > a.opt.TargetLatency {
+		// 同一批慢调用只减小一次
+		if now.Sub(a.lastDecrease) > a.opt.TargetLatency {
+			a.limit = math.Max(float64(a.opt.MinLimit), a.limit*a.opt.Backoff)
+			a.lastDecrease = now
+		}
+	} else if saturated {
+		a.limit += 1 / a.limit
+		if a.opt.MaxLimit > 0 {
+			a.limit = math.Min(float64(a.opt.MaxLimit), a.limit)
+		}
+	}
+	return int(a.limit)
+}
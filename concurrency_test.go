@@ -0,0 +1,227 @@
+package gorpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyQueueFull(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{MaxInFlight: 1})
+	release, err := l.Acquire(context.Background(), "S", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background(), "S", "A"); CodeOf(err) != CodeUnavailable {
+		t.Fatalf("acquire over the limit without a queue: %v", err)
+	}
+	release(0)
+	release, err = l.Acquire(context.Background(), "S", "A")
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	release(0)
+}
+
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 20 * time.Millisecond})
+	release, err := l.Acquire(context.Background(), "S", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release(0)
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), "S", "A"); CodeOf(err) != CodeResourceExhausted {
+		t.Fatalf("queue timeout: %v", err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("rejected after %v, before QueueTimeout", d)
+	}
+
+	// 调用方的上下文先结束时不是 ResourceExhausted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx, "S", "A"); CodeOf(err) != CodeUnavailable {
+		t.Fatalf("canceled while queued: %v", err)
+	}
+	if inflight, queued := l.InFlight(); inflight != 1 || queued != 0 {
+		t.Fatalf("InFlight() = %d, %d", inflight, queued)
+	}
+}
+
+// 释放许可时排队的调用按顺序获得许可
+func TestConcurrencyQueueHandoff(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{MaxInFlight: 1, MaxQueue: 1})
+	release, err := l.Acquire(context.Background(), "S", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan func(time.Duration))
+	go func() {
+		r, err := l.Acquire(context.Background(), "S", "A")
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- r
+	}()
+	for {
+		if _, queued := l.InFlight(); queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// 队列已满
+	if _, err := l.Acquire(context.Background(), "S", "A"); CodeOf(err) != CodeUnavailable {
+		t.Fatalf("acquire with a full queue: %v", err)
+	}
+	release(0)
+	select {
+	case r, ok := <-acquired:
+		if !ok {
+			t.FailNow()
+		}
+		r(0)
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued call did not get the permit")
+	}
+	if inflight, queued := l.InFlight(); inflight != 0 || queued != 0 {
+		t.Fatalf("InFlight() = %d, %d", inflight, queued)
+	}
+}
+
+func TestConcurrencyPerMethod(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{
+		MaxInFlight: 2,
+		Methods:     map[string]int{"S.Slow": 1},
+	})
+	slow, err := l.Acquire(context.Background(), "S", "Slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background(), "S", "Slow"); CodeOf(err) != CodeUnavailable {
+		t.Fatalf("second S.Slow: %v", err)
+	}
+	// 其他方法只受整个服务的限制
+	fast, err := l.Acquire(context.Background(), "S", "Fast")
+	if err != nil {
+		t.Fatalf("S.Fast: %v", err)
+	}
+	if _, err := l.Acquire(context.Background(), "S", "Fast"); CodeOf(err) != CodeUnavailable {
+		t.Fatalf("S.Fast over the global limit: %v", err)
+	}
+	slow(0)
+	// 整个服务的许可不足时方法的许可被还回去
+	if _, err := l.Acquire(context.Background(), "S", "Slow"); err != nil {
+		t.Fatalf("S.Slow after release: %v", err)
+	}
+	fast(0)
+}
+
+func TestConcurrencyAdaptive(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{
+		MaxInFlight: 2,
+		Adaptive:    &AdaptiveOptions{MinLimit: 2, MaxLimit: 6, TargetLatency: time.Millisecond},
+	})
+	// fill 占满当前的限制后全部以 latency 释放
+	fill := func(latency time.Duration) {
+		n := l.Limit()
+		releases := make([]func(time.Duration), n)
+		for i := range releases {
+			r, err := l.Acquire(context.Background(), "S", "A")
+			if err != nil {
+				t.Fatal(err)
+			}
+			releases[i] = r
+		}
+		for _, r := range releases {
+			r(latency)
+		}
+	}
+
+	// 延迟正常并且限制被占满时加性增大，不超过 MaxLimit
+	for range 100 {
+		fill(0)
+	}
+	if got := l.Limit(); got != 6 {
+		t.Fatalf("limit after fast calls = %d, want 6", got)
+	}
+
+	// 流式调用的持续时间不参与调整
+	for range 10 {
+		fill(-1)
+	}
+	if got := l.Limit(); got != 6 {
+		t.Fatalf("limit after stream releases = %d, want 6", got)
+	}
+
+	// 延迟超过目标时乘性减小，不低于 MinLimit
+	prev := l.Limit()
+	for range 50 {
+		time.Sleep(2 * time.Millisecond)
+		fill(time.Second)
+		if got := l.Limit(); got > prev {
+			t.Fatalf("limit grew from %d to %d on slow calls", prev, got)
+		}
+		prev = l.Limit()
+	}
+	if got := l.Limit(); got != 2 {
+		t.Fatalf("limit after slow calls = %d, want 2", got)
+	}
+}
+
+// 流式调用在整个流的期间占用许可，但流的持续时间不参与自适应调整
+func TestConcurrencyStream(t *testing.T) {
+	s, _ := startTestServer(t)
+	old := s.ConcurrencyLimiter
+	t.Cleanup(func() { s.ConcurrencyLimiter = old })
+	cli := newTestStubClient(t)
+	count := NewMethod[*testArgs, testReply](cli, testServiceName, "Count")
+	add := NewMethod[*testArgs, testReply](cli, testServiceName, "Add")
+
+	// openStream 打开一个不会自己结束的流，收到第一个返回值后调用 f，之后关闭流并等待服务端的方法返回
+	openStream := func(f func()) {
+		t.Helper()
+		select {
+		case <-testCountAborted:
+		default:
+		}
+		for _, err := range count.Stream(context.Background(), &testArgs{A: -1}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			f()
+			break
+		}
+		<-testCountAborted
+		// 许可在 invoke 返回时释放
+		for {
+			if inflight, _ := s.ConcurrencyLimiter.InFlight(); inflight == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	s.ConcurrencyLimiter = NewConcurrencyLimiter(ConcurrencyOptions{MaxInFlight: 1})
+	openStream(func() {
+		if _, err := add.Call(context.Background(), &testArgs{}); CodeOf(err) != CodeUnavailable {
+			t.Fatalf("call while a stream is open: %v", err)
+		}
+	})
+	if _, err := add.Call(context.Background(), &testArgs{}); err != nil {
+		t.Fatalf("call after the stream closed: %v", err)
+	}
+
+	// 流持续的时间远超过 TargetLatency，限制仍然不变
+	s.ConcurrencyLimiter = NewConcurrencyLimiter(ConcurrencyOptions{
+		MaxInFlight: 2,
+		Adaptive:    &AdaptiveOptions{MinLimit: 1, MaxLimit: 2, TargetLatency: time.Millisecond},
+	})
+	openStream(func() { time.Sleep(10 * time.Millisecond) })
+	if got := s.ConcurrencyLimiter.Limit(); got != 2 {
+		t.Fatalf("limit after a long stream = %d, want 2", got)
+	}
+}
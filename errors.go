@@ -0,0 +1,126 @@
+package gorpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Code 错误码，服务端通过 X-Code 头返回，客户端据此得到 *Error
+type Code string
+
+const (
+	CodeOK                Code = "OK"
+	CodeUnknown           Code = "Unknown" // 没有携带错误码的错误，一般是方法直接返回的 error
+	CodeInvalidArgument   Code = "InvalidArgument"
+	CodeNotFound          Code = "NotFound"
+	CodeDeadlineExceeded  Code = "DeadlineExceeded"
+	CodeUnavailable       Code = "Unavailable"
+	CodeInternal          Code = "Internal"
+	CodeUnauthenticated   Code = "Unauthenticated"   // 没有凭证或者凭证无效
+	CodePermissionDenied  Code = "PermissionDenied"  // 调用方没有调用这个方法的权限
+	CodeResourceExhausted Code = "ResourceExhausted" // 超过限流，可以在 RetryAfter 之后重试
+)
+
+// codeStatus 错误码对应的 HTTP 状态码
+var codeStatus = map[Code]int{
+	CodeOK:                http.StatusOK,
+	CodeUnknown:           http.StatusInternalServerError,
+	CodeInvalidArgument:   http.StatusBadRequest,
+	CodeNotFound:          http.StatusNotFound,
+	CodeDeadlineExceeded:  http.StatusGatewayTimeout,
+	CodeUnavailable:       http.StatusServiceUnavailable,
+	CodeInternal:          http.StatusInternalServerError,
+	CodeUnauthenticated:   http.StatusUnauthorized,
+	CodePermissionDenied:  http.StatusForbidden,
+	CodeResourceExhausted: http.StatusTooManyRequests,
+}
+
+// Error 带有错误码的错误
+// 方法可以返回 *Error 来控制返回给客户端的错误码和 HTTP 状态码
+type Error struct {
+	Code    Code
+	Message string
+	// 建议的重试等待时间，通过 Retry-After 头传递，为0时没有建议
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf 创建一个带有错误码的错误
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// CodeOf 获取错误的错误码
+// err 为 nil 时返回 CodeOK，不是 *Error 时返回 CodeUnknown
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// RetryAfterOf 获取错误中建议的重试等待时间，没有时返回0
+func RetryAfterOf(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+// setRetryAfter 错误中带有重试等待时间时设置 Retry-After 头，向上取整到秒
+func setRetryAfter(h http.Header, err error) {
+	if d := RetryAfterOf(err); d > 0 {
+		// 先除再进位，d 接近 math.MaxInt64 时也不会溢出
+		seconds := int64(d / time.Second)
+		if d%time.Second != 0 {
+			seconds++
+		}
+		h.Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+}
+
+// parseRetryAfter 解析 Retry-After 头，只支持秒数的形式
+func parseRetryAfter(v string) time.Duration {
+	seconds, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// HTTPStatus 获取错误码对应的 HTTP 状态码
+func HTTPStatus(code Code) int {
+	if status, ok := codeStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// codeFromStatus 根据 HTTP 状态码推断错误码，用于没有 X-Code 头的响应
+func codeFromStatus(status int) Code {
+	for code, s := range codeStatus {
+		if s == status && code != CodeUnknown {
+			return code
+		}
+	}
+	switch {
+	case status >= 400 && status < 500:
+		return CodeInvalidArgument
+	default:
+		return CodeUnknown
+	}
+}
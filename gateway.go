@@ -0,0 +1,292 @@
+package gorpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// RESTful 网关
+// 开启后每个方法都可以通过 POST /{service}/{method} 调用，请求体和响应体都是 JSON
+// 错误以 {"code": ..., "message": ...} 的形式返回，并使用错误码对应的 HTTP 状态码
+
+// GatewayOptions 网关设置
+type GatewayOptions struct {
+	// 允许通过 GET /{service}/{method}?field=value 调用参数类型简单的方法
+	// 简单类型指基本类型、基本类型的切片，以及只包含这两种字段的结构体
+	AllowGET bool
+}
+
+// gatewayError 网关返回的错误
+type gatewayError struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// EnableGateway 开启 RESTful 网关，与 /call 等接口同时存在
+// 服务本身和内置服务的方法都会被暴露，只能调用一次
+func (s *Server) EnableGateway(opt GatewayOptions) {
+	s.gateway = &opt
+	names := []string{s.Name}
+	for name := range s.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		http.HandleFunc("POST /"+name+"/{method}", s.gatewayPost(name))
+		if opt.AllowGET {
+			http.HandleFunc("GET /"+name+"/{method}", s.gatewayGet(name))
+		}
+	}
+	s.logger().Info("rpc server: gateway enabled", "service", s.Name)
+}
+
+// gatewayPost 处理 POST 请求，请求体为 JSON 格式的参数，为空时使用参数的零值
+func (s *Server) gatewayPost(service string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := s.authenticate(w, r)
+		if err != nil {
+			s.logger().Error("rpc server: authenticate failed", "err", err)
+			s.sendGatewayErr(w, err)
+			return
+		}
+		var body io.Reader = r.Body
+		if s.MaxBodySize > 0 {
+			body = http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+		}
+		s.serveGateway(ctx, w, service, r.PathValue("method"), func(arg any) error {
+			err := json.NewDecoder(body).Decode(arg)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// gatewayGet 处理 GET 请求，参数从查询字符串中获取
+func (s *Server) gatewayGet(service string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := s.authenticate(w, r)
+		if err != nil {
+			s.logger().Error("rpc server: authenticate failed", "err", err)
+			s.sendGatewayErr(w, err)
+			return
+		}
+		s.serveGateway(ctx, w, service, r.PathValue("method"), func(arg any) error {
+			return decodeQuery(r.URL.Query(), arg)
+		})
+	}
+}
+
+// serveGateway 查找方法，解码参数并调用，将结果以 JSON 格式返回
+// 参数:
+//   - ctx: 调用的上下文，带有调用方的信息
+//   - w: HTTP 响应写入器
+//   - service: 服务名
+//   - methodName: 方法名
+//   - decode: 将请求中的参数解码到 arg 中
+func (s *Server) serveGateway(ctx context.Context, w http.ResponseWriter, service, methodName string, decode func(arg any) error) {
+	method, ok := s.lookupMethod(service, methodName)
+	if !ok {
+		s.sendGatewayErr(w, Errorf(CodeNotFound, "rpc server: method not found %s", methodName))
+		return
+	}
+	argv := method.newArgv()
+	arg := argv.Interface()
+	if argv.Kind() != reflect.Ptr {
+		arg = argv.Addr().Interface()
+	}
+	if err := decode(arg); err != nil {
+		s.logger().Error("rpc server: decode gateway request failed", "err", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.sendGatewayErr(w, err)
+			return
+		}
+		s.sendGatewayErr(w, &Error{Code: CodeInvalidArgument, Message: err.Error()})
+		return
+	}
+	resp, err := s.invoke(ctx, service, method, arg)
+	if err != nil {
+		s.sendGatewayErr(w, err)
+		return
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		s.logger().Error("rpc server: encode response failed", "err", err)
+		s.sendGatewayErr(w, &Error{Code: CodeInternal, Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// sendGatewayErr 以 JSON 格式返回错误
+func (s *Server) sendGatewayErr(w http.ResponseWriter, err error) {
+	code := CodeOf(err)
+	status := HTTPStatus(code)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		code, status = CodeInvalidArgument, http.StatusRequestEntityTooLarge
+	}
+	b, _ := json.Marshal(gatewayError{Code: code, Message: err.Error()})
+	w.Header().Set("X-Code", string(code))
+	setRetryAfter(w.Header(), err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+// simpleQueryType 判断一个类型能否从查询字符串中解码
+func simpleQueryType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return simpleQueryField(t)
+	}
+	for _, index := range positionalFields(t) {
+		if !simpleQueryField(t.FieldByIndex(index).Type) {
+			return false
+		}
+	}
+	return true
+}
+
+func simpleQueryField(t reflect.Type) bool {
+	if isBytes(t) {
+		return true
+	}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isBytes 判断类型是否为 []byte，与 encoding/json 一样作为 base64 字符串处理
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+// decodeQuery 将查询字符串解码到参数中
+// 参数是结构体时，键为字段的 json 名字，切片字段可以重复多次；参数是基本类型时，键为 value
+// []byte 与 JSON 中一样是一个标准 base64 字符串，不能重复
+func decodeQuery(q url.Values, arg any) error {
+	v := reflect.ValueOf(arg).Elem()
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if !simpleQueryType(v.Type()) {
+		return fmt.Errorf("argument type %s can not be decoded from query string", v.Type())
+	}
+	if v.Kind() != reflect.Struct {
+		for key := range q {
+			if key != "value" {
+				return fmt.Errorf("unknown query parameter %s", key)
+			}
+		}
+		return setQueryValue(v, q["value"])
+	}
+
+	fields := map[string][]int{}
+	for _, index := range positionalFields(v.Type()) {
+		name, _ := jsonFieldName(v.Type().FieldByIndex(index))
+		fields[name] = index
+	}
+	for key, values := range q {
+		index, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown query parameter %s", key)
+		}
+		if err := setQueryValue(v.FieldByIndex(index), values); err != nil {
+			return fmt.Errorf("query parameter %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setQueryValue 将查询字符串中的值赋给基本类型或基本类型的切片
+func setQueryValue(v reflect.Value, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if isBytes(v.Type()) {
+		if len(values) > 1 {
+			return fmt.Errorf("expected a single base64 value, got %d", len(values))
+		}
+		b, err := base64.StdEncoding.DecodeString(values[0])
+		if err != nil {
+			return fmt.Errorf("invalid base64: %w", err)
+		}
+		v.SetBytes(b)
+		return nil
+	}
+	if v.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setScalar(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	if len(values) > 1 {
+		return fmt.Errorf("expected a single value, got %d", len(values))
+	}
+	return setScalar(v, values[0])
+}
+
+func setScalar(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
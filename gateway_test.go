@@ -0,0 +1,76 @@
+package gorpc
+
+import (
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type queryArgs struct {
+	Name  string `json:"name"`
+	IDs   []int  `json:"ids"`
+	Data  []byte `json:"data"`
+	Skip  string `json:"-"`
+	Count uint8
+}
+
+func TestDecodeQuery(t *testing.T) {
+	data := []byte{0, 1, 0xfb, 0xff}
+	q := url.Values{
+		"name":  {"n"},
+		"ids":   {"1", "2"},
+		"data":  {base64.StdEncoding.EncodeToString(data)},
+		"Count": {"7"},
+	}
+	var got queryArgs
+	if err := decodeQuery(q, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := queryArgs{Name: "n", IDs: []int{1, 2}, Data: data, Count: 7}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []url.Values{
+		{"data": {"not base64!"}},
+		{"data": {"AA==", "AQ=="}},
+		{"Skip": {"x"}},
+		{"Count": {"256"}},
+	} {
+		var args queryArgs
+		if err := decodeQuery(bad, &args); err == nil {
+			t.Errorf("decodeQuery(%v) should fail", bad)
+		}
+	}
+}
+
+// []byte 参数直接作为 value
+func TestDecodeQueryBytes(t *testing.T) {
+	var got []byte
+	if err := decodeQuery(url.Values{"value": {"aGVsbG8="}}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// 查询参数的文档与 decodeQuery 一致，[]byte 是一个 base64 字符串而不是数组
+func TestOpenAPIQueryParametersBytes(t *testing.T) {
+	params := openAPIQueryParameters(reflect.TypeOf(queryArgs{}))
+	byName := map[string]map[string]any{}
+	for _, p := range params {
+		m := p.(map[string]any)
+		byName[m["name"].(string)] = m
+	}
+	if _, ok := byName["data"]["style"]; ok {
+		t.Errorf("[]byte parameter should not be exploded: %v", byName["data"])
+	}
+	if s := byName["data"]["schema"].(map[string]any); s["type"] != "string" {
+		t.Errorf("[]byte parameter schema %v, want a string", s)
+	}
+	if byName["ids"]["style"] != "form" {
+		t.Errorf("slice parameter should use form style: %v", byName["ids"])
+	}
+}
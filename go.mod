@@ -1,2 +1,16 @@
 module github.com/wifi32767/HTTPGoRpc
+
 go 1.23.0
+
+require (
+	github.com/fxamacker/cbor/v2 v2.9.2
+	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.36.9
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
@@ -0,0 +1,371 @@
+package gorpc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+// 持久 gob 流
+// 客户端通过 HTTP Upgrade 把一个连接切换成 gob 流，之后在这个连接上的所有调用
+// 复用同一对 gob.Encoder/gob.Decoder，类型描述只需要发送一次
+// 每次调用依次发送 gobRequest 和参数，服务端依次返回 gobResponse 和返回值
+
+const (
+	GobStreamPath     = "/gob"
+	GobStreamProtocol = "gorpc-gob"
+)
+
+type gobRequest struct {
+	Method string
+	// 这次调用的父 span，格式与请求头相同
+	TraceParent string
+	TraceState  string
+	RequestID   string
+}
+
+type gobResponse struct {
+	Error      string // 为空表示调用成功，之后紧跟着返回值
+	Code       Code
+	RetryAfter time.Duration
+}
+
+// gobStream 处理 gob 流的升级请求，并在升级后的连接上循环处理调用
+func (s *Server) gobStream(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != GobStreamProtocol {
+		w.Header().Set("Upgrade", GobStreamProtocol)
+		s.sendErr(w, fmt.Errorf("rpc server: expected upgrade to %s", GobStreamProtocol), http.StatusUpgradeRequired)
+		return
+	}
+	ctx, err := s.authenticate(w, r)
+	if err != nil {
+		s.logger().Error("rpc server: authenticate failed", "err", err)
+		s.sendAuthErr(w, err)
+		return
+	}
+	header, err := s.parseHeader(r)
+	if err != nil {
+		s.logger().Error("rpc server: parse header failed", "err", err)
+		s.sendErr(w, err, http.StatusBadRequest)
+		return
+	}
+	if header.Option.MagicNumber != MagicNumber {
+		s.logger().Error("rpc server: invalid magic number", "magic_number", header.Option.MagicNumber)
+		s.sendErr(w, fmt.Errorf("rpc server: invalid magic number %d", header.Option.MagicNumber), http.StatusBadRequest)
+		return
+	}
+	if _, ok := s.builtins[header.Service]; s.Name != header.Service && !ok {
+		s.logger().Error("rpc server: service name mismatch", "service", header.Service)
+		s.sendErr(w, fmt.Errorf("rpc server: service name mismatch %s", header.Service), http.StatusBadRequest)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		s.sendErr(w, fmt.Errorf("rpc server: connection does not support upgrade"), http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		s.logger().Error("rpc server: hijack failed", "err", err)
+		return
+	}
+	defer conn.Close()
+	_, err = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + GobStreamProtocol + "\r\n\r\n")
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		s.logger().Error("rpc server: write upgrade response failed", "err", err)
+		return
+	}
+
+	stream := codec.NewGobStream(rw.Reader, conn)
+	// 与 /call 一样限制每个请求和参数的大小
+	stream.SetMaxMessageSize(s.MaxBodySize)
+	for {
+		if err := s.serveGob(ctx, stream, header.Service); err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logger().Error("rpc server: gob stream closed", "err", err)
+			}
+			return
+		}
+	}
+}
+
+// serveGob 在 gob 流上处理一次调用
+// 返回错误时流已经无法继续使用，需要关闭连接
+// 方法本身的错误会发送给客户端，不会作为返回值
+func (s *Server) serveGob(ctx context.Context, stream *codec.GobStream, service string) error {
+	var req gobRequest
+	if err := stream.Decode(&req); err != nil {
+		return s.gobDecodeErr(stream, err)
+	}
+	if sc, ok := ParseTraceParent(req.TraceParent); ok {
+		sc.TraceState = req.TraceState
+		ctx = ContextWithSpan(ctx, remoteSpan{sc})
+	}
+	// 每次调用有自己的请求 ID，没有时生成一个，不沿用升级请求的
+	ctx = ensureRequestID(WithRequestID(ctx, req.RequestID))
+	method, ok := s.lookupMethod(service, req.Method)
+	if !ok {
+		// 丢弃参数，保持流的同步
+		if err := stream.Decode(nil); err != nil {
+			return s.gobDecodeErr(stream, err)
+		}
+		return s.sendGob(stream, Errorf(CodeNotFound, "rpc server: method not found %s", req.Method), nil)
+	}
+	argv := method.newArgv()
+	arg := argv.Interface()
+	if argv.Kind() != reflect.Ptr {
+		arg = argv.Addr().Interface()
+	}
+	if err := stream.Decode(arg); err != nil {
+		return s.gobDecodeErr(stream, err)
+	}
+	resp, err := s.invoke(ctx, service, method, arg)
+	if err != nil {
+		return s.sendGob(stream, err, nil)
+	}
+	return s.sendGob(stream, nil, resp)
+}
+
+// gobDecodeErr 处理解码请求时的错误，流已经无法继续使用
+// 消息过大时尽量把错误告诉客户端，再关闭连接
+func (s *Server) gobDecodeErr(stream *codec.GobStream, err error) error {
+	if errors.Is(err, codec.ErrMessageTooLarge) {
+		_ = s.sendGob(stream, Errorf(CodeInvalidArgument, "rpc server: %v", err), nil)
+	}
+	return err
+}
+
+// sendGob 在 gob 流上发送一次调用的结果
+func (s *Server) sendGob(stream *codec.GobStream, callErr error, resp any) error {
+	if callErr != nil {
+		if err := stream.Encode(&gobResponse{Error: callErr.Error(), Code: CodeOf(callErr), RetryAfter: RetryAfterOf(callErr)}); err != nil {
+			return err
+		}
+		return stream.Flush()
+	}
+	if err := stream.Encode(&gobResponse{}); err != nil {
+		return err
+	}
+	if err := stream.Encode(resp); err != nil {
+		return err
+	}
+	return stream.Flush()
+}
+
+// GobConn 客户端的持久 gob 流连接，绑定到一个服务
+// 同一时间只处理一个调用，多个协程同时调用时会排队
+type GobConn struct {
+	mutex   sync.Mutex
+	conn    net.Conn
+	stream  *codec.GobStream
+	service string
+	client  *Client
+	closed  bool
+}
+
+// DialGob 建立一个到服务的持久 gob 流连接
+// 在这个连接上的调用不需要每次都发送类型描述，适合大量的小调用
+// 使用注册中心时，连接建立时选择一个服务端，之后的调用都发送到这个服务端
+// 参数:
+//   - ctx: 建立连接的上下文
+//   - service: 服务名
+//
+// 返回值:
+//   - *GobConn: 建立好的连接
+//   - error: 如果发生错误，则返回错误信息。
+func (c *Client) DialGob(ctx context.Context, service string) (*GobConn, error) {
+	addr := c.TargetAddr
+	if c.Opt.UseRegistry {
+		var err error
+		addr, err = c.getAddr(service)
+		if err != nil {
+			c.logger().Error("rpc client: get addr failed", "err", err)
+			return nil, err
+		}
+	}
+	h, err := json.Marshal(Header{
+		Service: service,
+		Option:  c.Opt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(baseURL(addr, c.Opt.TLSConfig))
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		c.logger().Error("rpc client: dial failed", "err", err)
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		config := &tls.Config{}
+		if c.Opt.TLSConfig != nil {
+			config = c.Opt.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+		// Upgrade 只能在 HTTP/1.1 上进行
+		config.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			c.logger().Error("rpc client: tls handshake failed", "err", err)
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	req, err := http.NewRequest("POST", u.String()+GobStreamPath, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", GobStreamProtocol)
+	req.Header.Set("X-Type", TypeCall)
+	req.Header.Set("X-Header", string(h))
+	if c.Opt.Credentials != nil {
+		if err := c.Opt.Credentials.Apply(req, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer conn.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("[%d] %s", resp.StatusCode, b)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	stream := codec.NewGobStream(br, conn)
+	stream.SetMaxMessageSize(c.Opt.MaxBodySize)
+	return &GobConn{
+		conn:    conn,
+		stream:  stream,
+		service: service,
+		client:  c,
+	}, nil
+}
+
+// Call 在持久连接上调用一个方法
+// ctx 超时或被取消时连接会被关闭，因为此时流的状态已经无法确定
+// 参数:
+//   - ctx: 上下文
+//   - method: 方法名
+//   - arg: 参数
+//   - ret: 返回值指针
+//
+// 返回值:
+//   - error: 如果发生错误，则返回错误信息。
+func (g *GobConn) Call(ctx context.Context, method string, arg any, ret any) (err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	done := observeCall(clientRequests, clientDuration, clientInFlight, g.service, method)
+	ctx = ensureRequestID(ctx)
+	addr := g.conn.RemoteAddr().String()
+	ctx, span := startSpan(ctx, g.client.Opt.Tracer, g.service+"/"+method, SpanKindClient)
+	span.SetAttribute("rpc.system", "gorpc")
+	span.SetAttribute("rpc.service", g.service)
+	span.SetAttribute("rpc.method", method)
+	span.SetAttribute("server.address", addr)
+	defer func() {
+		d := done(err)
+		span.End(err)
+		logCall(g.client.logger(), g.client.Opt.AccessLog, "rpc client: call", callAttrs(ctx, g.service, method, addr), d, err)
+	}()
+	if g.closed {
+		return fmt.Errorf("rpc client: gob connection closed")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = g.conn.SetDeadline(deadline)
+		defer g.conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = g.conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	err = g.roundTrip(ctx, method, arg, ret)
+	var remote *Error
+	if err != nil && !errors.As(err, &remote) {
+		// 传输错误，流已经不可用
+		g.closed = true
+		g.conn.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	// 服务端返回的错误不影响流的状态
+	return err
+}
+
+func (g *GobConn) roundTrip(ctx context.Context, method string, arg any, ret any) error {
+	req := gobRequest{Method: method}
+	req.RequestID, _ = RequestIDFromContext(ctx)
+	if sc := spanContextFrom(ctx); sc.IsValid() {
+		req.TraceParent = sc.TraceParent()
+		req.TraceState = sc.TraceState
+	}
+	if err := g.stream.Encode(&req); err != nil {
+		return err
+	}
+	if err := g.stream.Encode(arg); err != nil {
+		return err
+	}
+	if err := g.stream.Flush(); err != nil {
+		return err
+	}
+	var resp gobResponse
+	if err := g.stream.Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return &Error{Code: resp.Code, Message: resp.Error, RetryAfter: resp.RetryAfter}
+	}
+	return g.stream.Decode(ret)
+}
+
+// Close 关闭连接
+func (g *GobConn) Close() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	return g.conn.Close()
+}
@@ -0,0 +1,98 @@
+package gorpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGobStreamCall(t *testing.T) {
+	_, addr := startTestServer(t)
+	conn, err := NewClient(addr).DialGob(context.Background(), testServiceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		var reply testReply
+		if err := conn.Call(context.Background(), "Add", &testArgs{A: i, B: 1, Name: "n"}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.Sum != i+1 || reply.Name != "n" {
+			t.Fatalf("got %+v", reply)
+		}
+	}
+}
+
+// 超过 MaxBodySize 的参数被拒绝，服务端不会读入整个参数
+func TestGobStreamMaxBodySize(t *testing.T) {
+	_, addr := startTestServer(t)
+	cli := NewClient(addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := cli.DialGob(ctx, testServiceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var reply testReply
+	err = conn.Call(ctx, "Add", &testArgs{Name: strings.Repeat("x", 2<<20)}, &reply)
+	if err == nil {
+		t.Fatal("expected an error for an argument larger than MaxBodySize")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("server did not reject the argument in time: %v", err)
+	}
+
+	// 新的连接不受影响
+	conn2, err := cli.DialGob(ctx, testServiceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	if err := conn2.Call(ctx, "Add", &testArgs{A: 1, B: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 每次调用在连接上传输的字节数，对比 /call 上的 GobCodec 和持久 gob 流
+// 结果中的 wire-B/call 包括请求和响应的所有字节
+func BenchmarkGobCodecCall(b *testing.B) {
+	_, addr := startTestServer(b)
+	cli := NewClient(addr)
+	benchmarkCallBytes(b, func(args *testArgs, reply *testReply) error {
+		return cli.Call(context.Background(), testServiceName, "Add", args, reply)
+	})
+}
+
+func BenchmarkGobStreamCall(b *testing.B) {
+	_, addr := startTestServer(b)
+	conn, err := NewClient(addr).DialGob(context.Background(), testServiceName)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	benchmarkCallBytes(b, func(args *testArgs, reply *testReply) error {
+		return conn.Call(context.Background(), "Add", args, reply)
+	})
+}
+
+func benchmarkCallBytes(b *testing.B, call func(*testArgs, *testReply) error) {
+	args := &testArgs{A: 1, B: 2, Name: "bench"}
+	var reply testReply
+	// 第一次调用建立连接、发送类型描述，不计入结果
+	if err := call(args, &reply); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := testWireBytes.Load()
+	for i := 0; i < b.N; i++ {
+		if err := call(args, &reply); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(testWireBytes.Load()-start)/float64(b.N), "wire-B/call")
+}
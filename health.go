@@ -0,0 +1,160 @@
+package gorpc
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ServingStatus 服务的健康状态
+type ServingStatus string
+
+const (
+	StatusServing    ServingStatus = "SERVING"     // 正常提供服务
+	StatusNotServing ServingStatus = "NOT_SERVING" // 不提供服务，新的调用会被拒绝
+	StatusDraining   ServingStatus = "DRAINING"    // 正在下线，仍然处理调用，但不再接收新的流量
+)
+
+// HealthServiceName 内置健康检查服务的服务名
+// 通过 /call 调用 HealthServiceName.Check 可以查询服务的健康状态
+const HealthServiceName = "gorpc.Health"
+
+// HealthCheckRequest 健康检查的请求
+// Service 为空时查询整个服务器的状态
+type HealthCheckRequest struct {
+	Service string
+}
+
+// HealthCheckResponse 健康检查的返回
+type HealthCheckResponse struct {
+	Status ServingStatus
+}
+
+// health 维护服务器和各个服务的健康状态
+// 服务名为空的项表示整个服务器
+type health struct {
+	mutex   sync.RWMutex
+	status  map[string]ServingStatus
+	changed chan struct{} // 状态变化时通知心跳协程
+}
+
+func newHealth(serviceName string) *health {
+	return &health{
+		status: map[string]ServingStatus{
+			"":          StatusServing,
+			serviceName: StatusServing,
+		},
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// set 设置服务的状态，只能设置创建时已有的项
+// 不存在的服务名会被拒绝，否则拼错的服务名会让 ready 永远返回 false
+func (h *health) set(service string, status ServingStatus) error {
+	h.mutex.Lock()
+	old, ok := h.status[service]
+	if ok {
+		h.status[service] = status
+	}
+	h.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("health: unknown service %s", service)
+	}
+	if old != status {
+		select {
+		case h.changed <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (h *health) get(service string) (ServingStatus, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	status, ok := h.status[service]
+	return status, ok
+}
+
+// ready 服务器及其所有服务都处于 SERVING 状态时才算就绪
+func (h *health) ready() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, status := range h.status {
+		if status != StatusServing {
+			return false
+		}
+	}
+	return true
+}
+
+// accepting 判断一个服务是否接收新的调用
+// 只有 NOT_SERVING 会拒绝调用，DRAINING 状态下仍然处理已经路由过来的请求
+func (h *health) accepting(service string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.status[""] != StatusNotServing && h.status[service] != StatusNotServing
+}
+
+// registryStatus 上报给注册中心的状态
+func (h *health) registryStatus() ServingStatus {
+	if h.ready() {
+		return StatusServing
+	}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, status := range h.status {
+		if status == StatusNotServing {
+			return StatusNotServing
+		}
+	}
+	return StatusDraining
+}
+
+// SetServingStatus 设置服务的健康状态
+// service 为空时设置整个服务器的状态，否则必须是这个服务器的服务名，其他服务名返回错误
+// 状态变化会影响 /readyz 的结果，并通过心跳同步给注册中心
+func (s *Server) SetServingStatus(service string, status ServingStatus) error {
+	return s.health.set(service, status)
+}
+
+// ServingStatus 获取服务的健康状态
+// service 为空时获取整个服务器的状态
+func (s *Server) ServingStatus(service string) ServingStatus {
+	status, ok := s.health.get(service)
+	if !ok {
+		return StatusNotServing
+	}
+	return status
+}
+
+// healthz 存活探针，只要进程能够响应就返回200
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// readyz 就绪探针，服务器和所有服务都处于 SERVING 状态时返回200，否则返回503
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if !s.health.ready() {
+		s.sendErr(w, fmt.Errorf("not ready: %s", s.health.registryStatus()), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// healthService 内置的健康检查服务
+type healthService struct {
+	h *health
+}
+
+// Check 查询服务的健康状态
+func (hs *healthService) Check(req *HealthCheckRequest, resp *HealthCheckResponse) error {
+	status, ok := hs.h.get(req.Service)
+	if !ok {
+		return fmt.Errorf("health: unknown service %s", req.Service)
+	}
+	resp.Status = status
+	return nil
+}
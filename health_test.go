@@ -0,0 +1,124 @@
+package gorpc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestHealthRejectsUnknownService(t *testing.T) {
+	h := newHealth(testServiceName)
+	if err := h.set("Tset", StatusNotServing); err == nil {
+		t.Fatal("setting an unknown service should fail")
+	}
+	if !h.ready() {
+		t.Fatal("an unknown service name must not affect readiness")
+	}
+	if _, ok := h.get("Tset"); ok {
+		t.Fatal("unknown service was added")
+	}
+	select {
+	case <-h.changed:
+		t.Fatal("rejected update should not notify")
+	default:
+	}
+}
+
+func TestHealthChanged(t *testing.T) {
+	h := newHealth(testServiceName)
+	if err := h.set(testServiceName, StatusServing); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.changed:
+		t.Fatal("setting the same status should not notify")
+	default:
+	}
+	// 多次变化在被取走之前只保留一个通知
+	for _, status := range []ServingStatus{StatusDraining, StatusNotServing} {
+		if err := h.set(testServiceName, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-h.changed:
+	default:
+		t.Fatal("status change should notify")
+	}
+	select {
+	case <-h.changed:
+		t.Fatal("pending notifications should be coalesced")
+	default:
+	}
+	if got := h.registryStatus(); got != StatusNotServing {
+		t.Fatalf("registry status %s, want %s", got, StatusNotServing)
+	}
+}
+
+// 在测试期间修改共用服务端的健康状态，结束时恢复
+func setServingStatus(t *testing.T, s *Server, service string, status ServingStatus) {
+	t.Helper()
+	old := s.ServingStatus(service)
+	if err := s.SetServingStatus(service, status); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.SetServingStatus(service, old) })
+}
+
+func getStatus(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	s, addr := startTestServer(t)
+	if code, _ := getStatus(t, "http://"+addr+"/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz: status %d", code)
+	}
+	if code, _ := getStatus(t, "http://"+addr+"/readyz"); code != http.StatusOK {
+		t.Fatalf("/readyz: status %d", code)
+	}
+	if err := s.SetServingStatus("NoSuchService", StatusNotServing); err == nil {
+		t.Fatal("SetServingStatus should reject an unknown service")
+	}
+	if code, _ := getStatus(t, "http://"+addr+"/readyz"); code != http.StatusOK {
+		t.Fatalf("/readyz after an unknown service: status %d", code)
+	}
+
+	setServingStatus(t, s, testServiceName, StatusDraining)
+	code, body := getStatus(t, "http://"+addr+"/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz while draining: status %d", code)
+	}
+	if code, _ := getStatus(t, "http://"+addr+"/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz while draining: status %d, %s", code, body)
+	}
+
+	cli := NewClient(addr)
+	var resp HealthCheckResponse
+	if err := cli.Call(context.Background(), HealthServiceName, "Check", &HealthCheckRequest{Service: testServiceName}, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != StatusDraining {
+		t.Fatalf("Check: status %s, want %s", resp.Status, StatusDraining)
+	}
+	if err := cli.Call(context.Background(), HealthServiceName, "Check", &HealthCheckRequest{}, &resp); err != nil || resp.Status != StatusServing {
+		t.Fatalf("Check server: %s, %v", resp.Status, err)
+	}
+	if err := cli.Call(context.Background(), HealthServiceName, "Check", &HealthCheckRequest{Service: "NoSuchService"}, &resp); err == nil {
+		t.Fatal("Check should fail for an unknown service")
+	}
+
+	// NOT_SERVING 的服务拒绝新的调用
+	setServingStatus(t, s, testServiceName, StatusNotServing)
+	if err := cli.Call(context.Background(), testServiceName, "Add", &testArgs{}, &testReply{}); err == nil {
+		t.Fatal("call to a NOT_SERVING service should fail")
+	}
+}
@@ -0,0 +1,272 @@
+package gorpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceDesc 服务描述，由方法表生成
+type ServiceDesc struct {
+	Name    string       `json:"name"`
+	Builtin bool         `json:"builtin"` // 是否是内置服务
+	Methods []MethodDesc `json:"methods"`
+}
+
+// MethodDesc 方法描述
+type MethodDesc struct {
+	Name      string         `json:"name"`
+	ArgType   *TypeDesc      `json:"argType"`
+	RetType   *TypeDesc      `json:"retType"`
+	ArgSchema map[string]any `json:"argSchema"` // 参数的 JSON schema，即使用 json 编解码器时的消息格式
+	RetSchema map[string]any `json:"retSchema"`
+	Streaming bool           `json:"streaming,omitempty"` // 是否为流式方法，此时 ArgType 和 RetType 为每个消息的类型
+	Bidi      bool           `json:"bidi,omitempty"`      // 是否为双向流式方法
+}
+
+// TypeDesc 类型描述
+type TypeDesc struct {
+	Name   string      `json:"name,omitempty"` // 具名类型的完整名称，如 main.Req
+	Kind   string      `json:"kind"`           // reflect.Kind 的字符串形式
+	Elem   *TypeDesc   `json:"elem,omitempty"` // 指针、切片、数组、map 的元素类型
+	Key    *TypeDesc   `json:"key,omitempty"`  // map 的键类型
+	Fields []FieldDesc `json:"fields,omitempty"`
+}
+
+// FieldDesc 结构体字段描述
+type FieldDesc struct {
+	Name     string    `json:"name"`
+	JSONName string    `json:"jsonName"` // 使用 json 编解码器时的字段名
+	Type     *TypeDesc `json:"type"`
+}
+
+// Describe 返回服务器上所有服务的描述，包括内置服务
+// 结果按服务名和方法名排序
+func (s *Server) Describe() []ServiceDesc {
+	services := []ServiceDesc{describeService(s.Name, &s.ServiceMap, false)}
+	for name, m := range s.builtins {
+		services = append(services, describeService(name, m, true))
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return services
+}
+
+// introspect 处理内省请求，以 JSON 格式返回 Describe 的结果
+func (s *Server) introspect(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticateMetadata(w, r) {
+		return
+	}
+	b, err := json.Marshal(s.Describe())
+	if err != nil {
+		s.logger().Error("rpc server: marshal service description failed", "err", err)
+		s.sendErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+func describeService(name string, methods *sync.Map, builtin bool) ServiceDesc {
+	desc := ServiceDesc{
+		Name:    name,
+		Builtin: builtin,
+		Methods: []MethodDesc{},
+	}
+	methods.Range(func(key, value any) bool {
+		m := value.(*Method)
+		desc.Methods = append(desc.Methods, MethodDesc{
+			Name:      key.(string),
+			ArgType:   describeType(m.ArgType, map[reflect.Type]bool{}),
+			RetType:   describeType(m.RetType, map[reflect.Type]bool{}),
+			ArgSchema: jsonSchema(m.ArgType),
+			RetSchema: jsonSchema(m.RetType),
+			Streaming: m.streamType != nil,
+			Bidi:      m.bidi,
+		})
+		return true
+	})
+	sort.Slice(desc.Methods, func(i, j int) bool {
+		return desc.Methods[i].Name < desc.Methods[j].Name
+	})
+	return desc
+}
+
+// describeType 生成类型描述
+// visiting 记录正在展开的结构体，递归类型只展开一层
+func describeType(t reflect.Type, visiting map[reflect.Type]bool) *TypeDesc {
+	desc := &TypeDesc{
+		Name: t.String(),
+		Kind: t.Kind().String(),
+	}
+	if t.Name() == "" {
+		desc.Name = ""
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		desc.Elem = describeType(t.Elem(), visiting)
+	case reflect.Map:
+		desc.Key = describeType(t.Key(), visiting)
+		desc.Elem = describeType(t.Elem(), visiting)
+	case reflect.Struct:
+		if visiting[t] {
+			return desc
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, ok := jsonFieldName(f)
+			if !ok {
+				name = ""
+			}
+			desc.Fields = append(desc.Fields, FieldDesc{
+				Name:     f.Name,
+				JSONName: name,
+				Type:     describeType(f.Type, visiting),
+			})
+		}
+	}
+	return desc
+}
+
+// jsonFieldName 获取字段在 encoding/json 中的名字
+// 字段被忽略时返回 false
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder 生成类型在 encoding/json 编码下的 JSON schema
+// defs 为 nil 时结构体直接展开，递归引用处退化为任意 object；
+// 否则具名结构体放入 defs 中，通过 refPrefix+名字 的 $ref 引用
+type schemaBuilder struct {
+	visiting  map[reflect.Type]bool
+	defs      map[string]any
+	refPrefix string
+}
+
+// jsonSchema 生成直接展开的 JSON schema
+func jsonSchema(t reflect.Type) map[string]any {
+	b := &schemaBuilder{visiting: map[reflect.Type]bool{}}
+	return b.schema(t)
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if isBytes(t) {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if b.defs != nil && t.Name() != "" {
+			return b.ref(t)
+		}
+		if b.visiting[t] {
+			return map[string]any{"type": "object"}
+		}
+		b.visiting[t] = true
+		defer delete(b.visiting, t)
+		return b.structSchema(t)
+	default:
+		// interface 等无法确定的类型
+		return map[string]any{}
+	}
+}
+
+// ref 将具名结构体放入 defs 并返回对它的引用
+func (b *schemaBuilder) ref(t reflect.Type) map[string]any {
+	name := schemaName(t)
+	ref := map[string]any{"$ref": b.refPrefix + name}
+	if _, ok := b.defs[name]; ok {
+		return ref
+	}
+	// 先占位，递归类型会直接得到引用
+	b.defs[name] = map[string]any{}
+	b.defs[name] = b.structSchema(t)
+	return ref
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	b.addStructProperties(t, props, map[reflect.Type]bool{})
+	schema := map[string]any{"type": "object", "properties": props}
+	if t.Name() != "" {
+		schema["title"] = t.Name()
+	}
+	return schema
+}
+
+// addStructProperties 将结构体字段加入 properties
+// 没有 json 标签的匿名结构体字段会像 encoding/json 一样被展开
+// visited 记录已经展开过的结构体，互相嵌入指针的结构体只展开一次
+func (b *schemaBuilder) addStructProperties(t reflect.Type, props map[string]any, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			b.addStructProperties(ft, props, visited)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		props[name] = b.schema(f.Type)
+	}
+}
+
+// schemaName 具名类型在 defs 中的名字，只保留字母、数字和 . - _
+func schemaName(t reflect.Type) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, t.String())
+}
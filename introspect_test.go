@@ -0,0 +1,57 @@
+package gorpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 互相嵌入指针的结构体
+type embedA struct {
+	*embedB
+	NameA string
+}
+
+type embedB struct {
+	*embedA
+	NameB string
+}
+
+type embedSelf struct {
+	*embedSelf
+	Value int
+}
+
+func TestJSONSchemaEmbeddedCycle(t *testing.T) {
+	tests := []struct {
+		typ  reflect.Type
+		want []string
+	}{
+		{reflect.TypeOf(embedA{}), []string{"NameA", "NameB"}},
+		{reflect.TypeOf(&embedB{}), []string{"NameA", "NameB"}},
+		{reflect.TypeOf(embedSelf{}), []string{"Value"}},
+	}
+	for _, tt := range tests {
+		schema := jsonSchema(tt.typ)
+		props, ok := schema["properties"].(map[string]any)
+		if !ok {
+			t.Fatalf("%s: schema has no properties: %v", tt.typ, schema)
+		}
+		if len(props) != len(tt.want) {
+			t.Errorf("%s: properties %v, want %v", tt.typ, props, tt.want)
+		}
+		for _, name := range tt.want {
+			if _, ok := props[name]; !ok {
+				t.Errorf("%s: missing property %s", tt.typ, name)
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemaEmbeddedCycle(t *testing.T) {
+	b := &schemaBuilder{visiting: map[reflect.Type]bool{}, defs: map[string]any{}}
+	b.schema(reflect.TypeOf(embedA{}))
+	if _, ok := b.defs[schemaName(reflect.TypeOf(embedA{}))]; !ok {
+		t.Fatalf("embedA is missing from defs: %v", b.defs)
+	}
+	describeType(reflect.TypeOf(embedA{}), map[reflect.Type]bool{})
+}
@@ -0,0 +1,295 @@
+package gorpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// JSON-RPC 2.0 兼容接口
+// 方法名为 "Service.Method"，参数可以是按字段顺序排列的数组，也可以是按 json 字段名组织的对象
+// 支持批量调用和通知，请求和响应都使用 HTTP 状态码200，错误通过 error 对象返回
+// 认证失败和请求体过大时使用对应的 HTTP 状态码，响应同样是 id 为 null 的 error 对象
+
+const JSONRPCPath = "/jsonrpc"
+
+// JSON-RPC 2.0 规范中定义的错误码
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	JSONRPCServerError    = -32000 // 方法本身返回的错误
+)
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"` // 没有 id 的请求是通知，不需要响应
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"` // 成功时一定存在，可能是 null
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// JSONRPCError JSON-RPC 2.0 的 error 对象
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+var jsonNull = json.RawMessage("null")
+
+// jsonrpc 处理 JSON-RPC 2.0 请求
+func (s *Server) jsonrpc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.sendErr(w, fmt.Errorf("rpc server: jsonrpc requires POST"), http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, err := s.authenticate(w, r)
+	if err != nil {
+		s.logger().Error("rpc server: authenticate failed", "err", err)
+		s.sendJSONRPCErr(w, err)
+		return
+	}
+	var body io.Reader = r.Body
+	if s.MaxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		s.logger().Error("rpc server: read body failed", "err", err)
+		s.sendJSONRPCErr(w, err)
+		return
+	}
+
+	b = bytes.TrimSpace(b)
+	var resp any
+	if len(b) > 0 && b[0] == '[' {
+		resp = s.jsonrpcBatch(ctx, b)
+	} else if r := s.jsonrpcOne(ctx, b); r != nil {
+		resp = r
+	}
+
+	// 全部都是通知时不返回任何内容
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	msg, err := json.Marshal(resp)
+	if err != nil {
+		s.logger().Error("rpc server: marshal jsonrpc response failed", "err", err)
+		s.sendErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(msg)
+}
+
+// sendJSONRPCErr 在处理请求之前失败时返回 id 为 null 的 error 对象
+// 请求体过大时状态码为413，其他错误使用错误码对应的状态码
+func (s *Server) sendJSONRPCErr(w http.ResponseWriter, err error) {
+	status := HTTPStatus(CodeOf(err))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		status = http.StatusRequestEntityTooLarge
+		err = Errorf(CodeInvalidArgument, "rpc server: request body too large: %v", err)
+	}
+	msg, _ := json.Marshal(jsonrpcErrorResponse(jsonNull, JSONRPCServerError, err.Error(), CodeOf(err)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(msg)
+}
+
+// jsonrpcBatch 处理批量请求，最多 BatchConcurrency 个请求并发执行，响应的顺序与请求一致
+// 请求数超过 MaxBatchSize 时整个批量请求作为无效请求
+// 返回 nil 表示全部都是通知
+func (s *Server) jsonrpcBatch(ctx context.Context, b []byte) any {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return jsonrpcErrorResponse(jsonNull, JSONRPCParseError, "Parse error", err.Error())
+	}
+	if len(raws) == 0 {
+		return jsonrpcErrorResponse(jsonNull, JSONRPCInvalidRequest, "Invalid Request", "empty batch")
+	}
+	if s.MaxBatchSize > 0 && len(raws) > s.MaxBatchSize {
+		return jsonrpcErrorResponse(jsonNull, JSONRPCInvalidRequest, "Invalid Request",
+			fmt.Sprintf("batch of %d requests exceeds the limit of %d", len(raws), s.MaxBatchSize))
+	}
+	results := make([]*jsonrpcResponse, len(raws))
+	parallel(len(raws), s.batchConcurrency(), func(i int) {
+		results[i] = s.jsonrpcOne(ctx, raws[i])
+	})
+
+	resps := make([]*jsonrpcResponse, 0, len(results))
+	for _, r := range results {
+		if r != nil {
+			resps = append(resps, r)
+		}
+	}
+	if len(resps) == 0 {
+		return nil
+	}
+	return resps
+}
+
+// jsonrpcOne 处理单个请求，返回 nil 表示这是一个通知
+func (s *Server) jsonrpcOne(ctx context.Context, b []byte) *jsonrpcResponse {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if len(b) == 0 || errors.As(err, &syntaxErr) {
+			return jsonrpcErrorResponse(jsonNull, JSONRPCParseError, "Parse error", err.Error())
+		}
+		return jsonrpcErrorResponse(jsonNull, JSONRPCInvalidRequest, "Invalid Request", err.Error())
+	}
+	id := req.ID
+	if id == nil {
+		id = jsonNull
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return jsonrpcErrorResponse(id, JSONRPCInvalidRequest, "Invalid Request", nil)
+	}
+
+	result, rpcErr := s.jsonrpcCall(ctx, req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		return &jsonrpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: id}
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		s.logger().Error("rpc server: marshal jsonrpc result failed", "err", err)
+		return jsonrpcErrorResponse(id, JSONRPCInternalError, "Internal error", err.Error())
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Result: b, ID: id}
+}
+
+// jsonrpcCall 将 "Service.Method" 映射到方法表并调用
+func (s *Server) jsonrpcCall(ctx context.Context, name string, params json.RawMessage) (any, *JSONRPCError) {
+	// 内置服务的服务名中带有 "."，以最后一个 "." 分隔
+	i := strings.LastIndex(name, ".")
+	if i <= 0 {
+		return nil, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: "Method not found", Data: name}
+	}
+	service, methodName := name[:i], name[i+1:]
+	method, ok := s.lookupMethod(service, methodName)
+	if !ok {
+		return nil, &JSONRPCError{Code: JSONRPCMethodNotFound, Message: "Method not found", Data: name}
+	}
+
+	argv := method.newArgv()
+	arg := argv.Interface()
+	if argv.Kind() != reflect.Ptr {
+		arg = argv.Addr().Interface()
+	}
+	if err := decodeJSONRPCParams(params, arg); err != nil {
+		return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: "Invalid params", Data: err.Error()}
+	}
+
+	resp, err := s.invoke(ctx, service, method, arg)
+	if err != nil {
+		rpcErr := &JSONRPCError{Code: JSONRPCServerError, Message: err.Error()}
+		if code := CodeOf(err); code != CodeUnknown {
+			rpcErr.Data = code
+		}
+		return nil, rpcErr
+	}
+	return resp, nil
+}
+
+// decodeJSONRPCParams 将 params 解码到参数中
+//   - 没有 params 或者为 null 时使用零值
+//   - 对象按照 json 字段名解码，不允许未知字段
+//   - 数组在参数是切片或数组时整体解码；参数是结构体时按字段顺序赋值；否则只能有一个元素
+func decodeJSONRPCParams(params json.RawMessage, arg any) error {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, jsonNull) {
+		return nil
+	}
+	switch params[0] {
+	case '{':
+		decoder := json.NewDecoder(bytes.NewReader(params))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(arg)
+	case '[':
+	default:
+		return fmt.Errorf("params must be an array or an object")
+	}
+
+	v := reflect.ValueOf(arg).Elem()
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		return json.Unmarshal(params, arg)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(params, &items); err != nil {
+		return err
+	}
+	if v.Kind() != reflect.Struct {
+		if len(items) != 1 {
+			return fmt.Errorf("expected 1 positional param, got %d", len(items))
+		}
+		return json.Unmarshal(items[0], arg)
+	}
+
+	fields := positionalFields(v.Type())
+	if len(items) > len(fields) {
+		return fmt.Errorf("expected at most %d positional params, got %d", len(fields), len(items))
+	}
+	for i, item := range items {
+		f := v.FieldByIndex(fields[i])
+		if err := json.Unmarshal(item, f.Addr().Interface()); err != nil {
+			return fmt.Errorf("param %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// positionalFields 结构体中可以按位置赋值的字段，即 encoding/json 可见的导出字段
+func positionalFields(t reflect.Type) [][]int {
+	var fields [][]int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if _, ok := jsonFieldName(f); !ok {
+			continue
+		}
+		fields = append(fields, f.Index)
+	}
+	return fields
+}
+
+func jsonrpcErrorResponse(id json.RawMessage, code int, message string, data any) *jsonrpcResponse {
+	return &jsonrpcResponse{
+		JSONRPC: "2.0",
+		Error:   &JSONRPCError{Code: code, Message: message, Data: data},
+		ID:      id,
+	}
+}
@@ -0,0 +1,89 @@
+package gorpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// postJSONRPC 发送 JSON-RPC 请求，返回状态码和响应体
+func postJSONRPC(t *testing.T, addr, body string, header http.Header) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest("POST", "http://"+addr+JSONRPCPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+			t.Fatalf("response is not json: %v", err)
+		}
+	}
+	return resp.StatusCode, raw
+}
+
+func TestJSONRPCAuthError(t *testing.T) {
+	s, addr := startTestServer(t)
+	withAuthenticator(t, s, &BearerAuthenticator{Tokens: map[string]string{"secret": "alice"}})
+	status, body := postJSONRPC(t, addr, `{"jsonrpc":"2.0","method":"Test.Add","params":{"A":1},"id":1}`,
+		http.Header{"Authorization": {"Bearer wrong"}})
+	if status != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", status)
+	}
+	var resp jsonrpcResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.JSONRPC != "2.0" || string(resp.ID) != "null" || resp.Error == nil || resp.Error.Code != JSONRPCServerError {
+		t.Fatalf("unexpected response %s", body)
+	}
+	if resp.Error.Data != string(CodeUnauthenticated) {
+		t.Errorf("error data %v, want %s", resp.Error.Data, CodeUnauthenticated)
+	}
+}
+
+func TestJSONRPCBatch(t *testing.T) {
+	s, addr := startTestServer(t)
+	reqs := make([]string, 20)
+	for i := range reqs {
+		reqs[i] = fmt.Sprintf(`{"jsonrpc":"2.0","method":"Test.Add","params":[%d,1],"id":%d}`, i, i)
+	}
+	status, body := postJSONRPC(t, addr, "["+strings.Join(reqs, ",")+"]", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var resps []jsonrpcResponse
+	if err := json.Unmarshal(body, &resps); err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != len(reqs) {
+		t.Fatalf("got %d responses, want %d", len(resps), len(reqs))
+	}
+	for i, r := range resps {
+		var reply testReply
+		if err := json.Unmarshal(r.Result, &reply); err != nil || reply.Sum != i+1 || string(r.ID) != fmt.Sprint(i) {
+			t.Errorf("response %d: %+v", i, r)
+		}
+	}
+
+	s.MaxBatchSize = 10
+	t.Cleanup(func() { s.MaxBatchSize = 0 })
+	_, body = postJSONRPC(t, addr, "["+strings.Join(reqs, ",")+"]", nil)
+	var resp jsonrpcResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("oversized batch should get a single error object: %s", body)
+	}
+	if resp.Error == nil || resp.Error.Code != JSONRPCInvalidRequest {
+		t.Fatalf("unexpected response %s", body)
+	}
+}
@@ -0,0 +1,81 @@
+package gorpc
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"time"
+)
+
+// 日志
+// Server、Client 和注册中心都可以设置自己的 *slog.Logger，没有设置时使用 slog.Default()
+// 与一次调用有关的日志使用统一的属性: service、method、peer、request_id、duration、code、err
+
+// RequestIDHeader 携带请求 ID 的请求头
+// 客户端没有在上下文中设置请求 ID 时为每次调用生成一个，服务端没有收到时也会生成一个
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID 返回带有请求 ID 的上下文，用这个上下文发起的调用都使用这个请求 ID
+// 服务端方法的上下文中带有这次调用的请求 ID，用它发起的下游调用会沿用同一个请求 ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext 获取上下文中的请求 ID
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// ensureRequestID 上下文中没有请求 ID 时生成一个
+func ensureRequestID(ctx context.Context) context.Context {
+	if _, ok := RequestIDFromContext(ctx); ok {
+		return ctx
+	}
+	var b [8]byte
+	putRandom(b[:])
+	return WithRequestID(ctx, hex.EncodeToString(b[:]))
+}
+
+// callAttrs 一次调用的日志属性，peer 为对端的地址
+func callAttrs(ctx context.Context, service, method, peer string) []any {
+	attrs := []any{"service", service, "method", method}
+	if peer != "" {
+		attrs = append(attrs, "peer", peer)
+	}
+	if id, ok := RequestIDFromContext(ctx); ok {
+		attrs = append(attrs, "request_id", id)
+	}
+	return attrs
+}
+
+// logCall 记录一次调用的结果
+// 调用失败时总是记录一条错误日志，开启 accessLog 时成功的调用也记录一条日志
+func logCall(logger *slog.Logger, accessLog bool, msg string, attrs []any, d time.Duration, err error) {
+	attrs = append(attrs, "duration", d, "code", CodeOf(err))
+	if err != nil {
+		logger.Error(msg, append(attrs, "err", err)...)
+	} else if accessLog {
+		logger.Info(msg, attrs...)
+	}
+}
+
+// loggerOrDefault logger 为 nil 时返回 slog.Default()
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// logger 服务端使用的日志记录器
+func (s *Server) logger() *slog.Logger {
+	return loggerOrDefault(s.Logger)
+}
+
+// logger 客户端使用的日志记录器
+func (c *Client) logger() *slog.Logger {
+	return loggerOrDefault(c.Opt.Logger)
+}
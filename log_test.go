@@ -0,0 +1,158 @@
+package gorpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logBuffer 以 JSON 格式记录日志，可以被多个协程同时写入
+type logBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) logger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(b, nil))
+}
+
+// records 返回 request_id 为 id 的所有日志记录
+func (b *logBuffer) records(t *testing.T, id string) []map[string]any {
+	t.Helper()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		if r["request_id"] == id {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// withLoggers 在测试期间替换 slog.Default 和共用服务端的 Logger，并开启访问日志
+func withLoggers(t *testing.T, s *Server) (server, def *logBuffer) {
+	t.Helper()
+	server, def = &logBuffer{}, &logBuffer{}
+	oldDefault, oldLogger, oldAccessLog := slog.Default(), s.Logger, s.AccessLog
+	slog.SetDefault(def.logger())
+	s.Logger, s.AccessLog = server.logger(), true
+	t.Cleanup(func() {
+		slog.SetDefault(oldDefault)
+		s.Logger, s.AccessLog = oldLogger, oldAccessLog
+	})
+	return server, def
+}
+
+func TestLoggerReplacesDefault(t *testing.T) {
+	s, addr := startTestServer(t)
+	serverLog, defaultLog := withLoggers(t, s)
+	clientLog := &logBuffer{}
+	cli := NewClient(addr, &Options{Logger: clientLog.logger(), AccessLog: true})
+
+	const id = "req-logger-test"
+	ctx := WithRequestID(context.Background(), id)
+	if err := cli.Call(ctx, testServiceName, "Add", &testArgs{A: 1}, &testReply{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = cli.Call(ctx, testServiceName, "Fail", &testArgs{Name: "boom"}, &testReply{})
+
+	check := func(name string, records []map[string]any, msg string) {
+		t.Helper()
+		if len(records) != 2 {
+			t.Fatalf("%s: got %d records with request ID, want 2: %v", name, len(records), records)
+		}
+		ok, failed := records[0], records[1]
+		if ok["msg"] != msg || ok["level"] != "INFO" || ok["method"] != "Add" || ok["code"] != string(CodeOK) {
+			t.Errorf("%s access log = %v", name, ok)
+		}
+		if failed["msg"] != msg || failed["level"] != "ERROR" || failed["method"] != "Fail" || failed["err"] == nil {
+			t.Errorf("%s error log = %v", name, failed)
+		}
+		for _, r := range records {
+			if r["service"] != testServiceName || r["duration"] == nil || r["peer"] == nil {
+				t.Errorf("%s record is missing attributes: %v", name, r)
+			}
+		}
+	}
+	check("server", serverLog.records(t, id), "rpc server: call")
+	check("client", clientLog.records(t, id), "rpc client: call")
+	if records := defaultLog.records(t, id); len(records) != 0 {
+		t.Fatalf("slog.Default received %d records: %v", len(records), records)
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	s, addr := startTestServer(t)
+	serverLog, _ := withLoggers(t, s)
+
+	// 请求头中的请求 ID 原样返回
+	resp := postCall(t, addr, "Add", http.Header{RequestIDHeader: {"req-from-header"}}, strings.NewReader(`{"A":1}`))
+	if got := resp.Header.Get(RequestIDHeader); got != "req-from-header" {
+		t.Fatalf("echoed request ID = %q", got)
+	}
+	if records := serverLog.records(t, "req-from-header"); len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+
+	// 没有请求 ID 时生成一个，同样写入响应头和日志
+	resp = postCall(t, addr, "Add", nil, strings.NewReader(`{"A":1}`))
+	id := resp.Header.Get(RequestIDHeader)
+	if len(id) != 16 {
+		t.Fatalf("generated request ID = %q", id)
+	}
+	if records := serverLog.records(t, id); len(records) != 1 || records[0]["msg"] != "rpc server: call" {
+		t.Fatalf("records for generated ID = %v", records)
+	}
+
+	// 错误响应同样带有请求 ID
+	resp = postCall(t, addr, "Fail", http.Header{RequestIDHeader: {"req-failed"}}, strings.NewReader(`{"Name":"boom"}`))
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get(RequestIDHeader) != "req-failed" {
+		t.Fatalf("failed call: status %d, request ID %q", resp.StatusCode, resp.Header.Get(RequestIDHeader))
+	}
+}
+
+// 客户端为每次调用生成不同的请求 ID
+func TestClientGeneratesRequestID(t *testing.T) {
+	s, addr := startTestServer(t)
+	withLoggers(t, s)
+	clientLog := &logBuffer{}
+	cli := NewClient(addr, &Options{Logger: clientLog.logger(), AccessLog: true})
+	for range 2 {
+		if err := cli.Call(context.Background(), testServiceName, "Add", &testArgs{}, &testReply{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clientLog.mutex.Lock()
+	lines := strings.Split(strings.TrimSpace(clientLog.buf.String()), "\n")
+	clientLog.mutex.Unlock()
+	ids := map[any]bool{}
+	for _, line := range lines {
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		ids[r["request_id"]] = true
+	}
+	if len(lines) != 2 || len(ids) != 2 || ids[nil] || ids[""] {
+		t.Fatalf("request IDs = %v", ids)
+	}
+}
@@ -1,14 +1,26 @@
 package gorpc
 
-import "reflect"
+import (
+	"context"
+	"reflect"
+)
 
 type Method struct {
 	method   reflect.Method
 	ArgType  reflect.Type
 	RetType  reflect.Type
 	Receiver reflect.Value // 结构体的实例对象，用于作为call的参数
+	// 方法的第一个参数是否为 context.Context，即 func(ctx, req, resp) error 的形式
+	withContext bool
+	// 流式方法的 ServerStream[T] 或 BidiStream[Req, Resp] 类型，此时 ArgType 和 RetType 为每个消息的类型
+	// 不是流式方法时为 nil
+	streamType reflect.Type
+	// 是否为双向流式方法
+	bidi bool
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func (m *Method) newArgv() reflect.Value {
 	var argv reflect.Value
 	if m.ArgType.Kind() == reflect.Ptr {
@@ -0,0 +1,40 @@
+package gorpc
+
+import (
+	"time"
+
+	"github.com/wifi32767/HTTPGoRpc/metrics"
+)
+
+// 服务端和客户端的指标，都注册在 metrics.Default 中，通过 metrics.Path 以 Prometheus 文本格式输出
+// code 标签为 Code 的字符串形式，成功时为 OK
+var (
+	serverRequests = metrics.Default.NewCounterVec("gorpc_server_requests_total",
+		"Total number of calls handled by the server.", "service", "method", "code")
+	serverDuration = metrics.Default.NewHistogramVec("gorpc_server_request_duration_seconds",
+		"Latency of calls handled by the server.", nil, "service", "method")
+	serverInFlight = metrics.Default.NewGaugeVec("gorpc_server_in_flight",
+		"Number of calls currently being handled by the server.", "service", "method")
+
+	clientRequests = metrics.Default.NewCounterVec("gorpc_client_requests_total",
+		"Total number of calls sent by the client, counting each retry attempt.", "service", "method", "code")
+	clientDuration = metrics.Default.NewHistogramVec("gorpc_client_request_duration_seconds",
+		"Latency of calls sent by the client.", nil, "service", "method")
+	clientInFlight = metrics.Default.NewGaugeVec("gorpc_client_in_flight",
+		"Number of calls currently in flight from the client.", "service", "method")
+)
+
+// observeCall 记录一次调用开始，返回的函数在调用结束时传入调用的错误，并返回调用的耗时
+func observeCall(requests *metrics.CounterVec, duration *metrics.HistogramVec, inflight *metrics.GaugeVec,
+	service, method string) func(error) time.Duration {
+	g := inflight.WithLabelValues(service, method)
+	g.Inc()
+	start := time.Now()
+	return func(err error) time.Duration {
+		d := time.Since(start)
+		g.Dec()
+		duration.WithLabelValues(service, method).Observe(d.Seconds())
+		requests.WithLabelValues(service, method, string(CodeOf(err))).Inc()
+		return d
+	}
+}
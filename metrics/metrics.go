@@ -0,0 +1,436 @@
+// Package metrics 提供计数器、仪表和直方图，并以 Prometheus 文本格式输出
+// 不依赖外部库，只实现了 gorpc 需要的部分
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Path 指标接口的路径
+const Path = "/metrics"
+
+// DefBuckets 默认的直方图桶，单位为秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry 指标的集合，可以被多个协程同时使用
+type Registry struct {
+	mutex   sync.Mutex
+	metrics map[string]metric
+}
+
+// metric 可以输出为 Prometheus 文本格式的指标
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry 创建一个空的指标集合
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Default 默认的指标集合，gorpc 的服务端、客户端和注册中心都使用它
+var Default = NewRegistry()
+
+// register 注册一个指标，同名的指标只能注册一次
+func (r *Registry) register(name string, m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: duplicate metric %s", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteText 以 Prometheus 文本格式输出所有指标，按指标名排序
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler 返回输出所有指标的 HTTP 处理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+var (
+	handleOnce sync.Once
+	guardMutex sync.RWMutex
+	guards     []func(w http.ResponseWriter, r *http.Request) bool
+)
+
+// HandleDefault 在默认的 ServeMux 上注册 Path，输出 Default 中的指标
+// 同一个进程中的服务端和注册中心都会调用，只有第一次调用生效
+func HandleDefault() {
+	handleOnce.Do(func() {
+		handler := Default.Handler()
+		http.HandleFunc(Path, func(w http.ResponseWriter, r *http.Request) {
+			guardMutex.RLock()
+			list := guards
+			guardMutex.RUnlock()
+			for _, guard := range list {
+				if !guard(w, r) {
+					return
+				}
+			}
+			handler.ServeHTTP(w, r)
+		})
+	})
+}
+
+// AddDefaultGuard 为 HandleDefault 注册的接口添加一个输出指标之前的检查
+// guard 返回 false 时不输出指标，需要由 guard 写入错误响应，服务端用它对指标接口认证
+// 同一个进程中的多个服务端各自添加检查，所有检查都通过时才输出指标，不会互相覆盖
+func AddDefaultGuard(guard func(w http.ResponseWriter, r *http.Request) bool) {
+	guardMutex.Lock()
+	defer guardMutex.Unlock()
+	// 复制一份，避免影响正在遍历旧列表的请求
+	guards = append(guards[:len(guards):len(guards)], guard)
+}
+
+// family 同名指标的公共部分，按照标签值区分不同的序列
+type family[T any] struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	mutex  sync.Mutex
+	series map[string]*series[T]
+	newT   func() *T
+}
+
+type series[T any] struct {
+	labelValues []string
+	value       *T
+}
+
+func (f *family[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series[T]{labelValues: append([]string(nil), labelValues...), value: f.newT()}
+		f.series[key] = s
+	}
+	return s.value
+}
+
+// sorted 按照标签值排序的所有序列
+func (f *family[T]) sorted() []*series[T] {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]*series[T], 0, len(keys))
+	for _, key := range keys {
+		list = append(list, f.series[key])
+	}
+	return list
+}
+
+func (f *family[T]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	mutex sync.Mutex
+	value float64
+}
+
+// Inc 加一
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add 增加 v，v 不能为负数
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mutex.Lock()
+	c.value += v
+	c.mutex.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.value
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	f *family[Counter]
+}
+
+// NewCounterVec 创建并注册一个带标签的计数器
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{f: newFamily[Counter](name, help, "counter", labels)}
+	r.register(name, v)
+	return v
+}
+
+// WithLabelValues 获取标签值对应的计数器，标签值的顺序与创建时的标签名一致
+func (v *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	return v.f.with(labelValues)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.f.writeHeader(w)
+	for _, s := range v.f.sorted() {
+		writeSample(w, v.f.name, v.f.labels, s.labelValues, "", "", s.value.get())
+	}
+}
+
+// Gauge 可增可减的仪表
+type Gauge struct {
+	mutex sync.Mutex
+	value float64
+}
+
+// Set 设置为 v
+func (g *Gauge) Set(v float64) {
+	g.mutex.Lock()
+	g.value = v
+	g.mutex.Unlock()
+}
+
+// Add 增加 v，v 可以为负数
+func (g *Gauge) Add(v float64) {
+	g.mutex.Lock()
+	g.value += v
+	g.mutex.Unlock()
+}
+
+// Inc 加一
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec 减一
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) get() float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.value
+}
+
+// GaugeVec 带标签的仪表
+type GaugeVec struct {
+	f *family[Gauge]
+}
+
+// NewGaugeVec 创建并注册一个带标签的仪表
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{f: newFamily[Gauge](name, help, "gauge", labels)}
+	r.register(name, v)
+	return v
+}
+
+// WithLabelValues 获取标签值对应的仪表
+func (v *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	return v.f.with(labelValues)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.f.writeHeader(w)
+	for _, s := range v.f.sorted() {
+		writeSample(w, v.f.name, v.f.labels, s.labelValues, "", "", s.value.get())
+	}
+}
+
+// GaugeFunc 在输出时才计算的仪表，适合从已有的状态中统计
+type GaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func(emit func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc 创建并注册一个在输出时计算的仪表
+// collect 对每个序列调用一次 emit
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit func(value float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labels: labels, collect: collect}
+	r.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	type sample struct {
+		labelValues []string
+		value       float64
+	}
+	var samples []sample
+	g.collect(func(value float64, labelValues ...string) {
+		samples = append(samples, sample{append([]string(nil), labelValues...), value})
+	})
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].labelValues, "\xff") < strings.Join(samples[j].labelValues, "\xff")
+	})
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, escapeHelp(g.help))
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+	for _, s := range samples {
+		writeSample(w, g.name, g.labels, s.labelValues, "", "", s.value)
+	}
+}
+
+// Histogram 直方图
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64 // 每个桶的计数，不累加
+	sum     float64
+	count   uint64
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	f *family[Histogram]
+}
+
+// NewHistogramVec 创建并注册一个带标签的直方图，buckets 为 nil 时使用 DefBuckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	f := newFamily[Histogram](name, help, "histogram", labels)
+	f.newT = func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	}
+	v := &HistogramVec{f: f}
+	r.register(name, v)
+	return v
+}
+
+// WithLabelValues 获取标签值对应的直方图
+func (v *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	return v.f.with(labelValues)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.f.writeHeader(w)
+	for _, s := range v.f.sorted() {
+		h := s.value
+		h.mutex.Lock()
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += h.counts[i]
+			writeSample(w, v.f.name+"_bucket", v.f.labels, s.labelValues, "le", formatFloat(upper), float64(cumulative))
+		}
+		writeSample(w, v.f.name+"_bucket", v.f.labels, s.labelValues, "le", "+Inf", float64(h.count))
+		writeSample(w, v.f.name+"_sum", v.f.labels, s.labelValues, "", "", h.sum)
+		writeSample(w, v.f.name+"_count", v.f.labels, s.labelValues, "", "", float64(h.count))
+		h.mutex.Unlock()
+	}
+}
+
+func newFamily[T any](name, help, typ string, labels []string) *family[T] {
+	return &family[T]{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series[T]),
+		newT:   func() *T { return new(T) },
+	}
+}
+
+// writeSample 输出一行样本，extraName 不为空时追加一个标签，用于直方图的 le
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escapeLabel(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.\nSecond line with a \\ backslash.", "service", "code")
+	requests.WithLabelValues("b", "OK").Add(2)
+	requests.WithLabelValues("a", "OK").Inc()
+	// 标签值中的反斜杠、双引号和换行需要转义
+	requests.WithLabelValues(`x\y"z`+"\n", "Unknown").Inc()
+
+	inFlight := r.NewGaugeVec("test_in_flight", "In flight.")
+	inFlight.WithLabelValues().Set(3)
+	inFlight.WithLabelValues().Dec()
+
+	duration := r.NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 0.5}, "method")
+	h := duration.WithLabelValues("Add")
+	for _, v := range []float64{0.25, 0.5, 2} {
+		h.Observe(v)
+	}
+	duration.WithLabelValues("Empty")
+
+	r.NewGaugeFunc("test_instances", "Instances.", []string{"service"}, func(emit func(float64, ...string)) {
+		emit(2, "s2")
+		emit(1, "s1")
+	})
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="Add",le="0.5"} 2
+test_duration_seconds_bucket{method="Add",le="1"} 2
+test_duration_seconds_bucket{method="Add",le="+Inf"} 3
+test_duration_seconds_sum{method="Add"} 2.75
+test_duration_seconds_count{method="Add"} 3
+test_duration_seconds_bucket{method="Empty",le="0.5"} 0
+test_duration_seconds_bucket{method="Empty",le="1"} 0
+test_duration_seconds_bucket{method="Empty",le="+Inf"} 0
+test_duration_seconds_sum{method="Empty"} 0
+test_duration_seconds_count{method="Empty"} 0
+# HELP test_in_flight In flight.
+# TYPE test_in_flight gauge
+test_in_flight 2
+# HELP test_instances Instances.
+# TYPE test_instances gauge
+test_instances{service="s1"} 1
+test_instances{service="s2"} 2
+# HELP test_requests_total Requests.\nSecond line with a \\ backslash.
+# TYPE test_requests_total counter
+test_requests_total{service="a",code="OK"} 1
+test_requests_total{service="b",code="OK"} 2
+test_requests_total{service="x\\y\"z\n",code="Unknown"} 1
+`
+	if got := b.String(); got != want {
+		t.Fatalf("WriteText:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistryRejectsDuplicates(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup", "")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a duplicate metric should panic")
+		}
+	}()
+	r.NewGaugeVec("dup", "")
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("c", "", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("wrong number of label values should panic")
+		}
+	}()
+	v.WithLabelValues("only one")
+}
+
+// 多个检查都通过时才输出指标
+func TestHandleDefaultGuards(t *testing.T) {
+	HandleDefault()
+	HandleDefault()
+	deny := func(header string) func(http.ResponseWriter, *http.Request) bool {
+		return func(w http.ResponseWriter, r *http.Request) bool {
+			if r.Header.Get(header) != "" {
+				http.Error(w, "denied by "+header, http.StatusUnauthorized)
+				return false
+			}
+			return true
+		}
+	}
+	AddDefaultGuard(deny("X-Deny-A"))
+	AddDefaultGuard(deny("X-Deny-B"))
+
+	get := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", Path, nil)
+		if header != "" {
+			req.Header.Set(header, "1")
+		}
+		rec := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get(""); rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("without headers: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, header := range []string{"X-Deny-A", "X-Deny-B"} {
+		if rec := get(header); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), header) {
+			t.Fatalf("with %s: %d %s", header, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package gorpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// OpenAPI 文档
+// 描述 RESTful 网关暴露的接口，即 POST /{service}/{method}，请求体和响应体都是 JSON
+// 参数和返回值的 schema 由结构体字段和 json 标签生成，具名结构体放在 components/schemas 中
+
+const OpenAPIPath = "/openapi.json"
+
+const openAPISchemaPrefix = "#/components/schemas/"
+
+// errorSchemaName 网关错误在 components/schemas 中的名字
+const errorSchemaName = "gorpc.Error"
+
+// OpenAPI 生成服务器的 OpenAPI 3 文档，包括内置服务
+// 文档描述的是网关的接口，需要调用 EnableGateway 之后这些路径才可以访问
+// 开启了 AllowGET 时，参数类型简单的方法还会有对应的 GET 操作
+func (s *Server) OpenAPI() map[string]any {
+	b := &schemaBuilder{
+		visiting:  map[reflect.Type]bool{},
+		defs:      map[string]any{},
+		refPrefix: openAPISchemaPrefix,
+	}
+	b.defs[errorSchemaName] = map[string]any{
+		"type":     "object",
+		"required": []string{"code", "message"},
+		"properties": map[string]any{
+			"code":    map[string]any{"type": "string", "description": "错误码，与 X-Code 头相同"},
+			"message": map[string]any{"type": "string"},
+		},
+	}
+
+	paths := map[string]any{}
+	s.addOpenAPIPaths(paths, b, s.Name, &s.ServiceMap)
+	names := make([]string, 0, len(s.builtins))
+	for name := range s.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.addOpenAPIPaths(paths, b, name, s.builtins[name])
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   s.Name,
+			"version": "1.0.0",
+		},
+		"servers": []any{
+			map[string]any{"url": schemeOf(s.TLSConfig) + "://" + s.Addr + s.Port},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.defs,
+		},
+	}
+}
+
+// addOpenAPIPaths 将一个服务的所有方法加入 paths
+func (s *Server) addOpenAPIPaths(paths map[string]any, b *schemaBuilder, service string, methods *sync.Map) {
+	allowGET := s.gateway != nil && s.gateway.AllowGET
+	methods.Range(func(key, value any) bool {
+		name := key.(string)
+		m := value.(*Method)
+		// 服务端流式方法不能通过网关调用，不出现在文档中
+		if m.streamType != nil {
+			return true
+		}
+		responses := openAPIResponses(b.schema(m.RetType))
+		item := map[string]any{
+			"post": map[string]any{
+				"operationId": service + "." + name,
+				"tags":        []string{service},
+				"requestBody": map[string]any{
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": b.schema(m.ArgType)},
+					},
+				},
+				"responses": responses,
+			},
+		}
+		if allowGET && simpleQueryType(m.ArgType) {
+			item["get"] = map[string]any{
+				"operationId": service + "." + name + ".get",
+				"tags":        []string{service},
+				"parameters":  openAPIQueryParameters(m.ArgType),
+				"responses":   responses,
+			}
+		}
+		paths["/"+service+"/"+name] = item
+		return true
+	})
+}
+
+func openAPIResponses(ret map[string]any) map[string]any {
+	return map[string]any{
+		"200": map[string]any{
+			"description": "调用成功",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": ret},
+			},
+		},
+		"default": map[string]any{
+			"description": "调用失败，HTTP 状态码由错误码决定",
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{"$ref": openAPISchemaPrefix + errorSchemaName},
+				},
+			},
+		},
+	}
+}
+
+// openAPIQueryParameters 生成 GET 操作的查询参数，规则与 decodeQuery 相同
+func openAPIQueryParameters(t reflect.Type) []any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	b := &schemaBuilder{visiting: map[reflect.Type]bool{}}
+	if t.Kind() != reflect.Struct {
+		return []any{map[string]any{
+			"name":   "value",
+			"in":     "query",
+			"schema": b.schema(t),
+		}}
+	}
+	params := []any{}
+	for _, index := range positionalFields(t) {
+		f := t.FieldByIndex(index)
+		name, _ := jsonFieldName(f)
+		param := map[string]any{
+			"name":   name,
+			"in":     "query",
+			"schema": b.schema(f.Type),
+		}
+		if f.Type.Kind() == reflect.Slice && !isBytes(f.Type) {
+			param["style"] = "form"
+			param["explode"] = true
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// openapi 处理 OpenAPI 文档请求
+func (s *Server) openapi(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticateMetadata(w, r) {
+		return
+	}
+	b, err := json.Marshal(s.OpenAPI())
+	if err != nil {
+		s.logger().Error("rpc server: marshal openapi document failed", "err", err)
+		s.sendErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
@@ -1,16 +1,27 @@
 package gorpc
 
 import (
+	"crypto/tls"
+	"log/slog"
+
 	"github.com/wifi32767/HTTPGoRpc/codec"
+	"github.com/wifi32767/HTTPGoRpc/compress"
 )
 
 const MagicNumber int = 0x123456
 
+// 默认的压缩阈值，小于这个字节数的消息体不压缩
+const DefaultCompressThreshold = 1024
+
 const (
 	TypeCall     = "Call"
 	TypeRegister = "Reg"
 	TypePing     = "Ping"
 	TypeAsk      = "Ask"
+	TypeList     = "List"
+	TypeBatch    = "Batch"
+	TypeStream   = "Stream"
+	TypeBidi     = "Bidi"
 )
 
 type Header struct {
@@ -23,6 +34,30 @@ type Options struct {
 	MagicNumber int        // 验证传输正确性的魔数
 	CodecType   codec.Type // 编解码器类型
 	UseRegistry bool       // 是否使用注册中心
+	// 除 CodecType 之外还能接受的响应编解码器，按优先级排列
+	// 服务端可以选择其中之一编码响应，只在本地生效，不随请求发送
+	Accept []codec.Type `json:"-"`
+	// 压缩请求体使用的压缩器，同时声明接受这种压缩的响应，为空时不压缩
+	Compression compress.Type `json:"-"`
+	// 请求体达到这个字节数才压缩，为0时使用 DefaultCompressThreshold
+	CompressThreshold int `json:"-"`
+	// 响应体的最大字节数，为0时不限制，只在本地生效，不随请求发送
+	MaxBodySize int64 `json:"-"`
+	// 不为 nil 时使用 HTTPS 连接服务端和注册中心，包含客户端证书时可以用于 mTLS
+	// 可以使用 ClientTLSConfig 从文件加载，地址中已经带有协议时以地址为准
+	TLSConfig *tls.Config `json:"-"`
+	// 调用时携带的凭证，如 BearerToken、HMACCredentials，为 nil 时不携带
+	Credentials Credentials `json:"-"`
+	// 重试策略，为 nil 时不重试
+	Retry *RetryPolicy `json:"-"`
+	// 不为 nil 时为每次调用开始一个 span，没有设置时仍然传递上下文中已有的 span
+	Tracer Tracer `json:"-"`
+	// 日志记录器，为 nil 时使用 slog.Default()
+	Logger *slog.Logger `json:"-"`
+	// 为 true 时每次调用都记录一条日志，否则只记录失败的调用
+	AccessLog bool `json:"-"`
+	// 双向流的接收窗口，即服务端最多可以连续发送多少个还没有被取走的消息，为0时使用 DefaultStreamWindow
+	StreamWindow int `json:"-"`
 }
 
 var DefaultOptions = &Options{
@@ -0,0 +1,57 @@
+package gorpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoCall(t *testing.T) {
+	_, addr := startTestServer(t)
+	cli := NewClient(addr, &Options{CodecType: codec.TypeProto})
+	var reply wrapperspb.StringValue
+	if err := cli.Call(context.Background(), testServiceName, "Upper", wrapperspb.String("abc"), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Value != "ABC" {
+		t.Fatalf("got %q", reply.Value)
+	}
+}
+
+// 参数和返回值不是 proto.Message 的方法在解码请求之前就被拒绝
+func TestProtoRejectsNonProtoMethod(t *testing.T) {
+	_, addr := startTestServer(t)
+	cli := NewClient(addr, &Options{CodecType: codec.TypeProto})
+	err := cli.Call(context.Background(), testServiceName, "Add", wrapperspb.String("x"), &wrapperspb.StringValue{})
+	if CodeOf(err) != CodeInvalidArgument {
+		t.Fatalf("got %v, want %s", err, CodeInvalidArgument)
+	}
+}
+
+func TestCheckMethodTypes(t *testing.T) {
+	s, _ := startTestServer(t)
+	proto := codec.NewCodec(codec.TypeProto)
+	json := codec.NewCodec(codec.TypeJson)
+	upper, _ := s.lookupMethod(testServiceName, "Upper")
+	add, _ := s.lookupMethod(testServiceName, "Add")
+	tests := []struct {
+		name    string
+		req     codec.Codec
+		resp    codec.Codec
+		method  *Method
+		wantErr bool
+	}{
+		{"proto method with proto", proto, proto, upper, false},
+		{"proto method with json", json, json, upper, false},
+		{"plain method with json", json, json, add, false},
+		{"plain argument", proto, json, add, true},
+		{"plain reply", json, proto, add, true},
+	}
+	for _, tt := range tests {
+		if err := checkMethodTypes(tt.req, tt.resp, tt.method); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
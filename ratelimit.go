@@ -0,0 +1,211 @@
+package gorpc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// 限流
+// 使用令牌桶，可以同时设置全局、每个方法和每个调用方的限制，一次调用需要所有相关的桶中都有令牌
+// 被拒绝的调用返回 CodeResourceExhausted，并通过 Retry-After 告诉客户端需要等待多久
+
+// RateLimit 令牌桶的参数
+type RateLimit struct {
+	Rate  float64 // 每秒补充的令牌数，必须大于0
+	Burst int     // 桶的容量，即允许的突发调用数，为0时等于 Rate 向上取整
+}
+
+// RateLimitOptions 限流设置，不需要的限制留空即可
+type RateLimitOptions struct {
+	Global *RateLimit // 整个服务的限制
+	// 每个方法的限制，键为 "Service.Method"
+	Methods map[string]RateLimit
+	// 每个调用方的限制，每个调用方有独立的令牌桶
+	PerCaller *RateLimit
+	// 调用方的标识，默认依次使用认证得到的主体名、CallerHeader 指定的请求头和远端 IP
+	CallerKey func(ctx context.Context) string
+	// 作为调用方标识的请求头，如 X-Caller-ID，为空时不使用
+	CallerHeader string
+}
+
+// callerIdleTimeout 调用方的令牌桶超过这个时间没有使用时会被清理
+const callerIdleTimeout = time.Minute
+
+// maxRateLimitWait 返回给客户端的等待时间的上限，避免 Rate 极小时换算成 Duration 溢出
+const maxRateLimitWait = time.Hour
+
+// RateLimiter 服务端的限流器，可以被多个协程同时使用
+type RateLimiter struct {
+	opt       RateLimitOptions
+	mutex     sync.Mutex
+	global    *tokenBucket
+	methods   map[string]*tokenBucket
+	callers   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter 创建限流器
+// 任何一个限制的 Rate 不大于0时 panic，这样的桶用完之后永远无法补充令牌
+func NewRateLimiter(opt RateLimitOptions) *RateLimiter {
+	if opt.Global != nil {
+		mustValidRate("global", *opt.Global)
+	}
+	for name, limit := range opt.Methods {
+		mustValidRate(name, limit)
+	}
+	if opt.PerCaller != nil {
+		mustValidRate("per caller", *opt.PerCaller)
+	}
+	now := time.Now()
+	l := &RateLimiter{
+		opt:       opt,
+		methods:   make(map[string]*tokenBucket),
+		callers:   make(map[string]*tokenBucket),
+		lastSweep: now,
+	}
+	if opt.Global != nil {
+		l.global = newTokenBucket(*opt.Global, now)
+	}
+	for name, limit := range opt.Methods {
+		l.methods[name] = newTokenBucket(limit, now)
+	}
+	return l
+}
+
+// Allow 判断一次调用是否被允许
+// 不允许时返回需要等待的时间，此时不消耗任何令牌
+// 参数:
+//   - ctx: 调用的上下文，用于确定调用方
+//   - service: 服务名
+//   - method: 方法名
+//
+// 返回值:
+//   - bool: 是否允许
+//   - time.Duration: 不允许时，至少需要等待的时间
+func (l *RateLimiter) Allow(ctx context.Context, service, method string) (bool, time.Duration) {
+	now := time.Now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	buckets := make([]*tokenBucket, 0, 3)
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+	if b, ok := l.methods[service+"."+method]; ok {
+		buckets = append(buckets, b)
+	}
+	if l.opt.PerCaller != nil {
+		l.sweep(now)
+		key := l.callerKey(ctx)
+		b, ok := l.callers[key]
+		if !ok {
+			b = newTokenBucket(*l.opt.PerCaller, now)
+			l.callers[key] = b
+		}
+		buckets = append(buckets, b)
+	}
+
+	// 所有的桶都有令牌时才消耗，避免被拒绝的调用消耗其他桶的令牌
+	var wait time.Duration
+	for _, b := range buckets {
+		b.refill(now)
+		if d := b.wait(); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// mustValidRate 检查令牌桶的参数
+func mustValidRate(name string, limit RateLimit) {
+	if !(limit.Rate > 0) {
+		panic(fmt.Sprintf("rpc server: rate limit %s: rate must be positive, got %v", name, limit.Rate))
+	}
+}
+
+// callerKey 获取调用方的标识
+func (l *RateLimiter) callerKey(ctx context.Context) string {
+	if l.opt.CallerKey != nil {
+		return l.opt.CallerKey(ctx)
+	}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return "principal:" + p.Name
+	}
+	peer, ok := PeerFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if l.opt.CallerHeader != "" && peer.Header != nil {
+		if v := peer.Header.Get(l.opt.CallerHeader); v != "" {
+			return "header:" + v
+		}
+	}
+	host, _, err := net.SplitHostPort(peer.Addr)
+	if err != nil {
+		host = peer.Addr
+	}
+	return "addr:" + host
+}
+
+// sweep 清理长时间没有使用的调用方令牌桶
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < callerIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.callers {
+		if now.Sub(b.last) > callerIdleTimeout {
+			delete(l.callers, key)
+		}
+	}
+}
+
+// tokenBucket 令牌桶，需要在外部加锁
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(limit.Rate))
+	}
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// wait 得到一个令牌需要等待的时间，有令牌时为0，最多为 maxRateLimitWait
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	d := (1 - b.tokens) / b.rate * float64(time.Second)
+	if !(d < float64(maxRateLimitWait)) {
+		return maxRateLimitWait
+	}
+	return max(time.Duration(d), 1)
+}
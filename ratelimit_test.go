@@ -0,0 +1,67 @@
+package gorpc
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiterRejectsNonPositiveRate(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  RateLimitOptions
+	}{
+		{"global zero", RateLimitOptions{Global: &RateLimit{Rate: 0, Burst: 1}}},
+		{"method negative", RateLimitOptions{Methods: map[string]RateLimit{"Test.Add": {Rate: -1}}}},
+		{"per caller NaN", RateLimitOptions{PerCaller: &RateLimit{Rate: math.NaN()}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("NewRateLimiter should panic")
+				}
+			}()
+			NewRateLimiter(tt.opt)
+		})
+	}
+}
+
+// Rate 极小时等待时间不能溢出成负数
+func TestRateLimiterWaitIsBounded(t *testing.T) {
+	l := NewRateLimiter(RateLimitOptions{Global: &RateLimit{Rate: 1e-300, Burst: 1}})
+	if ok, _ := l.Allow(context.Background(), "Test", "Add"); !ok {
+		t.Fatal("first call should be allowed")
+	}
+	ok, wait := l.Allow(context.Background(), "Test", "Add")
+	if ok {
+		t.Fatal("second call should be rejected")
+	}
+	if wait <= 0 || wait > maxRateLimitWait {
+		t.Fatalf("wait = %v, want in (0, %v]", wait, maxRateLimitWait)
+	}
+}
+
+func TestSetRetryAfter(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, ""},
+		{-time.Second, ""},
+		{1, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Duration(math.MaxInt64), strconv.FormatInt(math.MaxInt64/int64(time.Second)+1, 10)},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		setRetryAfter(h, &Error{Code: CodeResourceExhausted, RetryAfter: tt.d})
+		if got := h.Get("Retry-After"); got != tt.want {
+			t.Errorf("setRetryAfter(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -13,6 +13,17 @@ type LoadBalance interface {
 	Get(name string, timeoutFactor float64) (string, error)
 }
 
+// 可选接口，负载均衡实现了这个接口时，注册中心会把服务上报的健康状态同步给它
+// 不处于 SERVING 状态的服务不应该被 Get 选中
+type StatusUpdater interface {
+	UpdateStatus(name, addr string, status gorpc.ServingStatus)
+}
+
+// 可选接口，负载均衡实现了这个接口时，注册中心可以列出所有已注册的服务实例
+type Lister interface {
+	List() []ServiceInfo
+}
+
 type Constructor func() LoadBalance
 type Type string
 type ConstructorMap map[Type]Constructor
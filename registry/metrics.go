@@ -0,0 +1,14 @@
+package registry
+
+import "github.com/wifi32767/HTTPGoRpc/metrics"
+
+// 注册中心的指标，与同一进程中的服务端共用 metrics.Default
+// instances 和 evictions 由 RoundRobin 维护，自定义的负载均衡需要自行更新
+var (
+	registrations = metrics.Default.NewCounterVec("gorpc_registry_registrations_total",
+		"Total number of service registrations received by the registry.", "service")
+	instances = metrics.Default.NewGaugeVec("gorpc_registry_instances",
+		"Number of registered instances of each service.", "service")
+	evictions = metrics.Default.NewCounterVec("gorpc_registry_evictions_total",
+		"Total number of instances evicted after missing heartbeats.", "service")
+)
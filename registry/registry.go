@@ -1,19 +1,26 @@
 package registry
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"sort"
 
 	gorpc "github.com/wifi32767/HTTPGoRpc"
+	"github.com/wifi32767/HTTPGoRpc/metrics"
 )
 
-// 这个设置比较原始，只有这两个项目
 type Options struct {
 	TimeoutFactor float64
 	LoadBalance   Type
+	// 不为 nil 时使用 HTTPS，需要包含注册中心的证书，设置 ClientCAs 和 ClientAuth 可以要求服务端和客户端提供证书
+	// 可以使用 gorpc.ServerTLSConfig 从文件加载
+	TLSConfig *tls.Config
+	// 日志记录器，为 nil 时使用 slog.Default()
+	Logger *slog.Logger
 }
 
 var DefaultOptions = &Options{
@@ -45,7 +52,7 @@ func NewRegistry(port string, opts ...*Options) *Registry {
 	}
 	lb := NewLoadBalance(opt.LoadBalance)
 	if lb == nil {
-		slog.Error("registry: load balance not found")
+		loggerOrDefault(opt.Logger).Error("registry: load balance not found", "load_balance", opt.LoadBalance)
 		return nil
 	}
 	srv := &Registry{
@@ -58,6 +65,8 @@ func NewRegistry(port string, opts ...*Options) *Registry {
 	http.HandleFunc("/register", srv.register)
 	http.HandleFunc("/get", srv.get)
 	http.HandleFunc("/heartbeat", srv.heartBeat)
+	http.HandleFunc("/list", srv.list)
+	metrics.HandleDefault()
 	return srv
 }
 
@@ -85,9 +94,14 @@ func parseOptions(opts ...*Options) (*Options, error) {
 }
 
 // Run 启动注册表服务并监听传入的请求。
+// 设置了 TLSConfig 时使用 HTTPS。
 // 如果服务启动成功，则返回 nil，否则返回错误。
 func (s *Registry) Run() error {
-	slog.Info("registry: Running")
+	s.logger().Info("registry: Running")
+	if s.Option.TLSConfig != nil {
+		s.srv.TLSConfig = s.Option.TLSConfig
+		return s.srv.ListenAndServeTLS("", "")
+	}
 	return s.srv.ListenAndServe()
 }
 
@@ -99,25 +113,27 @@ func (s *Registry) Run() error {
 func (s *Registry) register(w http.ResponseWriter, r *http.Request) {
 	// 判断是否是一个注册
 	if r.Header.Get("X-Type") != gorpc.TypeRegister {
-		slog.Error("registry: wrong message type")
+		s.logger().Error("registry: wrong message type", "type", r.Header.Get("X-Type"))
 		s.sendErr(w, fmt.Errorf("registry: wrong message type"), http.StatusBadRequest)
 		return
 	}
 	// 获取服务信息
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
-		slog.Error("registry: read body failed", "err", err)
+		s.logger().Error("registry: read body failed", "err", err)
 		s.sendErr(w, err, http.StatusBadRequest)
 		return
 	}
 	info := gorpc.ServiceInfo{}
 	if err = json.Unmarshal(b, &info); err != nil {
-		slog.Error("registry: parse body failed", "err", err)
+		s.logger().Error("registry: parse body failed", "err", err)
 		s.sendErr(w, err, http.StatusBadRequest)
 		return
 	}
 	// 注册服务
 	s.LoadBalance.Register(info)
+	registrations.WithLabelValues(info.Name).Inc()
+	s.updateStatus(info)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -125,18 +141,18 @@ func (s *Registry) register(w http.ResponseWriter, r *http.Request) {
 // 它执行以下步骤：
 // 1. 检查请求头 "X-Type" 是否等于 gorpc.TypeAsk。如果不是，则记录错误并发送 BadRequest 响应。
 // 2. 读取请求体以获取方法名称。
-// 3. 使用 LoadBalance 组件获取给定方法名称的服务地址。
+// 3. 使用 LoadBalance 组件获取给定方法名称的服务地址，服务使用 HTTPS 时地址带有协议。
 func (s *Registry) get(w http.ResponseWriter, r *http.Request) {
 	// 判断是否是一个调用
 	if r.Header.Get("X-Type") != gorpc.TypeAsk {
-		slog.Error("registry: wrong message type")
+		s.logger().Error("registry: wrong message type", "type", r.Header.Get("X-Type"))
 		s.sendErr(w, fmt.Errorf("registry: wrong message type"), http.StatusBadRequest)
 		return
 	}
 	// 获取服务信息
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
-		slog.Error("registry: read body failed", "err", err)
+		s.logger().Error("registry: read body failed", "err", err)
 		s.sendErr(w, err, http.StatusBadRequest)
 		return
 	}
@@ -144,7 +160,7 @@ func (s *Registry) get(w http.ResponseWriter, r *http.Request) {
 	// 获取服务
 	addr, err := s.LoadBalance.Get(methodName, s.Option.TimeoutFactor)
 	if err != nil {
-		slog.Error("registry: get service failed", "err", err)
+		s.logger().Error("registry: get service failed", "service", methodName, "err", err)
 		s.sendErr(w, err, http.StatusNotFound)
 		return
 	}
@@ -153,6 +169,39 @@ func (s *Registry) get(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(addr))
 }
 
+// list 处理列出服务实例的请求。
+// 它首先检查请求头中的 "X-Type" 是否为 gorpc.TypeList，
+// 然后以 JSON 数组的形式返回负载均衡中记录的所有服务实例，按服务名和地址排序。
+// 负载均衡没有实现 Lister 接口时返回 501。
+func (s *Registry) list(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Type") != gorpc.TypeList {
+		s.logger().Error("registry: wrong message type", "type", r.Header.Get("X-Type"))
+		s.sendErr(w, fmt.Errorf("registry: wrong message type"), http.StatusBadRequest)
+		return
+	}
+	l, ok := s.LoadBalance.(Lister)
+	if !ok {
+		s.sendErr(w, fmt.Errorf("registry: load balance does not support listing"), http.StatusNotImplemented)
+		return
+	}
+	services := l.List()
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Name != services[j].Name {
+			return services[i].Name < services[j].Name
+		}
+		return services[i].Addr < services[j].Addr
+	})
+	b, err := json.Marshal(services)
+	if err != nil {
+		s.logger().Error("registry: marshal service list failed", "err", err)
+		s.sendErr(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
 // heartBeat 处理心跳请求。
 // 它首先检查请求头中的 "X-Type" 是否为 gorpc.TypePing，以确定是否为心跳消息。
 // 然后读取请求体并将其反序列化为 gorpc.ServiceInfo 结构。
@@ -160,26 +209,53 @@ func (s *Registry) get(w http.ResponseWriter, r *http.Request) {
 func (s *Registry) heartBeat(w http.ResponseWriter, r *http.Request) {
 	// 判断是否是一个心跳
 	if r.Header.Get("X-Type") != gorpc.TypePing {
-		slog.Error("registry heartbeat: wrong message type")
+		s.logger().Error("registry: wrong message type", "type", r.Header.Get("X-Type"))
 		return
 	}
 	// 获取信息
 	b, err := io.ReadAll(r.Body)
-	slog.Debug(string(b))
 	if err != nil {
-		slog.Error("registry heartbeat: read body failed", "err", err)
+		s.logger().Error("registry: read body failed", "err", err)
 		return
 	}
 	info := gorpc.ServiceInfo{}
 	err = json.Unmarshal(b, &info)
 	if err != nil {
-		slog.Error("registry heartbeat: body unmarshal failed", "err", err)
+		s.logger().Error("registry: parse body failed", "err", err)
 	}
 	// 更新心跳时间
 	s.LoadBalance.HeartBeat(info.Name, info.Addr)
+	s.updateStatus(info)
 	w.WriteHeader(http.StatusOK)
 }
 
+// updateStatus 将服务上报的健康状态同步给负载均衡
+// 负载均衡没有实现 StatusUpdater 时忽略
+func (s *Registry) updateStatus(info gorpc.ServiceInfo) {
+	u, ok := s.LoadBalance.(StatusUpdater)
+	if !ok {
+		return
+	}
+	status := info.Status
+	if status == "" {
+		status = gorpc.StatusServing
+	}
+	u.UpdateStatus(info.Name, info.Addr, status)
+}
+
+// logger 注册中心使用的日志记录器
+func (s *Registry) logger() *slog.Logger {
+	return loggerOrDefault(s.Option.Logger)
+}
+
+// loggerOrDefault logger 为 nil 时返回 slog.Default()
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
 // sendErr 向 HTTP 响应写入错误信息和状态码。
 // 参数:
 //
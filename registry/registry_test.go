@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	gorpc "github.com/wifi32767/HTTPGoRpc"
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+type echoService struct{}
+
+type echoArgs struct {
+	Msg string
+}
+
+func (echoService) Echo(args *echoArgs, reply *echoArgs) error {
+	reply.Msg = args.Msg
+	return nil
+}
+
+// newTestCerts 生成测试用的 CA 和一个同时用于服务端和客户端的证书
+// 证书对本机所有的 IP 地址有效，服务端向注册中心注册的是本机的局域网地址
+func newTestCerts(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "registry test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ips []net.IP
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// 注册中心、服务端和客户端之间全部使用 mTLS
+func TestRegistryOverHTTPS(t *testing.T) {
+	cert, pool := newTestCerts(t)
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	clientConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// 注册中心在默认的 ServeMux 上注册处理函数，在随机端口上提供服务
+	if NewRegistry(":0", &Options{TimeoutFactor: 3, LoadBalance: TypeRoundRobin, TLSConfig: serverConfig, Logger: logger}) == nil {
+		t.Fatal("NewRegistry failed")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	regSrv := &http.Server{ErrorLog: log.New(io.Discard, "", 0)}
+	t.Cleanup(func() { regSrv.Close() })
+	go regSrv.Serve(tls.NewListener(ln, serverConfig))
+	registryAddr := "https://" + ln.Addr().String()
+
+	// 服务端向注册中心注册的地址带有端口，需要先选定一个空闲的端口
+	free, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+	s, err := gorpc.NewServer("Echo", ":"+strconv.Itoa(port), echoService{}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Logger = logger
+	s.TLSConfig = serverConfig
+	s.RegistryTLSConfig = clientConfig
+	go s.RunWithRegistry(registryAddr)
+
+	cli := gorpc.NewClient(registryAddr, &gorpc.Options{
+		CodecType:   codec.TypeJson,
+		UseRegistry: true,
+		TLSConfig:   clientConfig,
+		Logger:      logger,
+	})
+	// 服务端启动和注册是异步的，等待第一次调用成功
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var reply echoArgs
+		err := cli.Call(context.Background(), "Echo", "Echo", &echoArgs{Msg: "hi"}, &reply)
+		if err == nil {
+			if reply.Msg != "hi" {
+				t.Fatalf("reply = %+v", reply)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call through HTTPS registry: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 没有客户端证书时注册中心拒绝连接
+	noCert := gorpc.NewClient(registryAddr, &gorpc.Options{
+		CodecType:   codec.TypeJson,
+		UseRegistry: true,
+		TLSConfig:   &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		Logger:      logger,
+	})
+	if err := noCert.Call(context.Background(), "Echo", "Echo", &echoArgs{}, &echoArgs{}); err == nil {
+		t.Fatal("call without client certificate should fail")
+	}
+}
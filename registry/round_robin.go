@@ -13,6 +13,16 @@ type ServiceInfo struct {
 	Addr         string
 	LastPingTime time.Time
 	Timeout      time.Duration
+	Status       gorpc.ServingStatus
+	Scheme       string // 服务使用的协议，为空时视为 http
+}
+
+// URL 服务的地址，使用 HTTPS 时带有协议，以兼容只接受 host:port 的客户端
+func (i *ServiceInfo) URL() string {
+	if i.Scheme == "" || i.Scheme == "http" {
+		return i.Addr
+	}
+	return i.Scheme + "://" + i.Addr
 }
 
 // 这个设计使用链表维护
@@ -41,6 +51,7 @@ func (l *RingLinkedList) Add(name, addr string, timeout time.Duration) *ServiceI
 			Addr:         addr,
 			LastPingTime: time.Now(),
 			Timeout:      timeout,
+			Status:       gorpc.StatusServing,
 		},
 	}
 	if l.Size == 0 {
@@ -109,7 +120,9 @@ func (r *RoundRobin) Register(info gorpc.ServiceInfo) {
 		r.ServiceMap[name] = NewLinkedList()
 	}
 	i := r.ServiceMap[name].Add(name, addr, info.Timeout)
+	i.Scheme = info.Scheme
 	r.Info[addr] = i
+	instances.WithLabelValues(name).Set(float64(r.ServiceMap[name].Size))
 }
 
 func (r *RoundRobin) HeartBeat(name, addr string) {
@@ -121,27 +134,52 @@ func (r *RoundRobin) HeartBeat(name, addr string) {
 	r.Info[addr].LastPingTime = time.Now()
 }
 
+func (r *RoundRobin) UpdateStatus(name, addr string, status gorpc.ServingStatus) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.Info[addr]; !ok {
+		return
+	}
+	r.Info[addr].Status = status
+}
+
+func (r *RoundRobin) List() []ServiceInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	list := make([]ServiceInfo, 0, len(r.Info))
+	for _, info := range r.Info {
+		list = append(list, *info)
+	}
+	return list
+}
+
+// Get 轮询选择一个服务
+// 最多检查一圈，检查时移除心跳超时的服务，返回第一个没有超时并且处于 SERVING 状态的服务
 func (r *RoundRobin) Get(name string, factor float64) (string, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	if _, ok := r.ServiceMap[name]; !ok {
+	list, ok := r.ServiceMap[name]
+	if !ok {
 		return "", fmt.Errorf("service %s not found", name)
 	}
-	for r.ServiceMap[name].Size > 0 {
-		cur := r.ServiceMap[name].GetCur()
-		if cur == nil {
-			return "", fmt.Errorf("service %s not found", name)
-		}
-		if cur.LastPingTime.Add(cur.Timeout * time.Duration(factor)).Before(time.Now()) {
-			r.ServiceMap[name].RemoveCur()
+	now := time.Now()
+	for checked, size := 0, list.Size; checked < size; checked++ {
+		cur := list.GetCur()
+		if cur.LastPingTime.Add(cur.Timeout * time.Duration(factor)).Before(now) {
+			// RemoveCur 之后 Cur 指向下一个服务
+			list.RemoveCur()
 			delete(r.Info, cur.Addr)
+			evictions.WithLabelValues(name).Inc()
+			instances.WithLabelValues(name).Set(float64(list.Size))
 			continue
 		}
-		break
+		list.Next()
+		if cur.Status == gorpc.StatusServing {
+			return cur.URL(), nil
+		}
 	}
-	if r.ServiceMap[name].Size == 0 {
+	if list.Size == 0 {
 		return "", fmt.Errorf("service %s not found", name)
 	}
-	defer r.ServiceMap[name].Next()
-	return r.ServiceMap[name].GetCur().Addr, nil
+	return "", fmt.Errorf("service %s not serving", name)
 }
@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	gorpc "github.com/wifi32767/HTTPGoRpc"
+)
+
+func TestRoundRobinRotates(t *testing.T) {
+	r := NewRoundRobin().(*RoundRobin)
+	for _, addr := range []string{"a:1", "b:1", "c:1"} {
+		r.Register(gorpc.ServiceInfo{Name: "S", Addr: addr, Timeout: time.Minute})
+	}
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		addr, err := r.Get("S", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[addr]++
+	}
+	for _, addr := range []string{"a:1", "b:1", "c:1"} {
+		if seen[addr] != 2 {
+			t.Fatalf("uneven rotation: %v", seen)
+		}
+	}
+}
+
+// 当前服务不在 SERVING 状态时，跳过它之后的服务也要检查心跳是否超时
+func TestRoundRobinSkipsExpiredAfterNotServing(t *testing.T) {
+	r := NewRoundRobin().(*RoundRobin)
+	for _, addr := range []string{"a:1", "b:1", "c:1"} {
+		r.Register(gorpc.ServiceInfo{Name: "S", Addr: addr, Timeout: time.Minute})
+	}
+	list := r.ServiceMap["S"]
+	// 让当前服务不可用，下一个服务心跳超时
+	first := list.GetCur()
+	first.Status = gorpc.StatusNotServing
+	expired := list.Cur.Next.Body
+	expired.LastPingTime = time.Now().Add(-time.Hour)
+
+	for i := 0; i < 4; i++ {
+		addr, err := r.Get("S", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr == expired.Addr {
+			t.Fatalf("expired instance %s was returned", addr)
+		}
+		if addr == first.Addr {
+			t.Fatalf("not serving instance %s was returned", addr)
+		}
+	}
+	if _, ok := r.Info[expired.Addr]; ok {
+		t.Fatalf("expired instance %s was not evicted", expired.Addr)
+	}
+}
+
+func TestRoundRobinAllExpired(t *testing.T) {
+	r := NewRoundRobin().(*RoundRobin)
+	r.Register(gorpc.ServiceInfo{Name: "S", Addr: "a:1", Timeout: time.Millisecond})
+	r.Register(gorpc.ServiceInfo{Name: "S", Addr: "b:1", Timeout: time.Millisecond})
+	time.Sleep(5 * time.Millisecond)
+	if addr, err := r.Get("S", 1); err == nil {
+		t.Fatalf("got %s from a service whose instances all expired", addr)
+	}
+	if len(r.Info) != 0 {
+		t.Fatalf("expired instances were not evicted: %v", r.Info)
+	}
+}
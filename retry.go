@@ -0,0 +1,71 @@
+package gorpc
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// RetryPolicy 客户端的重试策略
+// 只重试服务端明确拒绝、方法还没有执行的错误，默认为 CodeResourceExhausted 和 CodeUnavailable
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试的次数，包括第一次，小于2时不重试
+	Backoff     time.Duration // 第一次重试前的等待时间，之后每次翻倍，为0时使用 DefaultRetryBackoff
+	MaxBackoff  time.Duration // 等待时间的上限，为0时不限制
+	// 需要重试的错误码，为空时使用 CodeResourceExhausted 和 CodeUnavailable
+	Codes []Code
+}
+
+// DefaultRetryBackoff 默认的重试等待时间
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// retryable 判断错误是否需要重试
+func (p *RetryPolicy) retryable(err error) bool {
+	code := CodeOf(err)
+	if len(p.Codes) == 0 {
+		return code == CodeResourceExhausted || code == CodeUnavailable
+	}
+	return slices.Contains(p.Codes, code)
+}
+
+// backoff 第 attempt 次尝试失败后需要等待的时间
+// 错误中带有 Retry-After 时至少等待这么久
+func (p *RetryPolicy) backoff(attempt int, err error) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	// 没有 MaxBackoff 时在溢出之前停止翻倍
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	// 加入随机抖动，避免多个客户端同时重试
+	d = d/2 + rand.N(d/2+1)
+	if after := RetryAfterOf(err); after > d {
+		d = after
+	}
+	return d
+}
+
+// withRetry 按照重试策略执行 f，policy 为 nil 时只执行一次
+// ctx 结束时停止等待，返回最后一次的错误
+func withRetry(ctx context.Context, policy *RetryPolicy, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || policy == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(policy.backoff(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
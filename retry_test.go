@@ -0,0 +1,91 @@
+package gorpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	// 抖动之后的等待时间在 [d/2, d] 之间
+	for _, tt := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	} {
+		for range 20 {
+			if d := p.backoff(tt.attempt, nil); d < tt.want/2 || d > tt.want {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v]", tt.attempt, d, tt.want/2, tt.want)
+			}
+		}
+	}
+
+	// Retry-After 比退避时间长时以 Retry-After 为准
+	err := &Error{Code: CodeResourceExhausted, RetryAfter: 3 * time.Second}
+	if d := p.backoff(1, err); d != 3*time.Second {
+		t.Fatalf("backoff with Retry-After = %v", d)
+	}
+}
+
+// 没有 MaxBackoff 时翻倍不能溢出
+func TestRetryBackoffUnbounded(t *testing.T) {
+	p := &RetryPolicy{Backoff: time.Millisecond}
+	prev := time.Duration(0)
+	for _, attempt := range []int{1, 10, 40, 62, 63, 64, 100, 1000, math.MaxInt32} {
+		d := p.backoff(attempt, nil)
+		if d <= 0 {
+			t.Fatalf("backoff(%d) = %v", attempt, d)
+		}
+		if attempt <= 40 && d < prev {
+			t.Fatalf("backoff(%d) = %v, less than %v", attempt, d, prev)
+		}
+		prev = d
+	}
+	if d := (&RetryPolicy{Backoff: math.MaxInt64}).backoff(10, nil); d <= 0 {
+		t.Fatalf("backoff with maximal Backoff = %v", d)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	calls := 0
+	err := withRetry(context.Background(), p, func() error {
+		calls++
+		return Errorf(CodeUnavailable, "unavailable")
+	})
+	if calls != 3 || CodeOf(err) != CodeUnavailable {
+		t.Fatalf("calls = %d, err = %v", calls, err)
+	}
+
+	// 不可重试的错误只尝试一次
+	calls = 0
+	err = withRetry(context.Background(), p, func() error {
+		calls++
+		return errors.New("boom")
+	})
+	if calls != 1 || err == nil {
+		t.Fatalf("calls = %d, err = %v", calls, err)
+	}
+
+	// 上下文结束时停止等待
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	slow := &RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}
+	err = withRetry(ctx, slow, func() error {
+		calls++
+		return Errorf(CodeUnavailable, "unavailable")
+	})
+	if calls != 1 || err == nil {
+		t.Fatalf("calls = %d, err = %v", calls, err)
+	}
+}
@@ -2,7 +2,10 @@ package gorpc
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,6 +17,8 @@ import (
 	"time"
 
 	"github.com/wifi32767/HTTPGoRpc/codec"
+	"github.com/wifi32767/HTTPGoRpc/compress"
+	"github.com/wifi32767/HTTPGoRpc/metrics"
 )
 
 // 这两个结构体用于注册中心的注册
@@ -21,6 +26,8 @@ type ServiceInfo struct {
 	Name    string
 	Addr    string
 	Timeout time.Duration
+	Status  ServingStatus // 服务的健康状态，为空时视为 SERVING
+	Scheme  string        // 服务使用的协议，http 或 https，为空时视为 http
 }
 
 type Service struct {
@@ -33,15 +40,52 @@ type Server struct {
 	Addr             string
 	Port             string
 	HeartBeatTimeout time.Duration
-	ServiceMap       sync.Map
-	srv              *http.Server
-	cli              *http.Client
+	MaxBodySize      int64 // 请求体的最大字节数，超过时返回413，为0时不限制
+	// 响应体达到这个字节数并且客户端接受压缩时才压缩，为0时使用 DefaultCompressThreshold
+	CompressThreshold int
+	// 不为 nil 时使用 HTTPS，需要包含服务端证书，设置 ClientCAs 和 ClientAuth 可以开启 mTLS
+	// 可以使用 ServerTLSConfig 从文件加载
+	TLSConfig *tls.Config
+	// 连接使用 HTTPS 的注册中心时的客户端 TLS 配置
+	RegistryTLSConfig *tls.Config
+	// 不为 nil 时对所有调用请求进行认证，可以使用 ChainAuthenticator 组合多种方式
+	Authenticator Authenticator
+	// 授权规则，按顺序使用第一条匹配的规则
+	AuthRules []AuthRule
+	// 设置了 Authenticator 时，/introspect、/openapi.json 和 /metrics 默认需要认证过的主体
+	// 为 true 时这些接口不需要认证，任何人都可以访问
+	PublicMetadata bool
+	// 不为 nil 时对调用限流，超过限制时返回 CodeResourceExhausted
+	RateLimiter *RateLimiter
+	// 不为 nil 时限制同时执行的调用数，超过限制并且队列已满时返回 CodeUnavailable
+	ConcurrencyLimiter *ConcurrencyLimiter
+	// 不为 nil 时为每次调用开始一个 span，父 span 来自请求头中的 traceparent
+	Tracer Tracer
+	// 日志记录器，为 nil 时使用 slog.Default()
+	Logger *slog.Logger
+	// 为 true 时每次调用都记录一条日志，否则只记录失败的调用
+	AccessLog bool
+	// 一次批量调用中最多的调用数，为0时不限制，同时限制 /batch 和 JSON-RPC 的批量请求
+	MaxBatchSize int
+	// 并发执行批量调用时同时执行的调用数，为0时使用 DefaultBatchConcurrency，同样用于 JSON-RPC 的批量请求
+	BatchConcurrency int
+	// 双向流的接收窗口，即客户端最多可以连续发送多少个还没有被取走的消息，为0时使用 DefaultStreamWindow
+	StreamWindow int
+	ServiceMap   sync.Map
+	srv          *http.Server
+	cli          *http.Client
+	// 内置服务，服务名 -> 方法表
+	builtins map[string]*sync.Map
+	health   *health
+	gateway  *GatewayOptions // 为 nil 时没有开启网关
 }
 
 // NewServer 创建一个新的 RPC 服务器实例，该实例包含指定的服务名称、端口、服务实现和心跳超时时间。
 // 初始化服务器，并注册提供的服务实现中的所有公共方法以供远程过程调用使用。
 // 这些方法必须是形如func(req, resp any) error的形式
 // 其中req是请求参数，resp是返回参数的指针
+// 也可以是func(ctx context.Context, req, resp any) error的形式，ctx 中带有调用方的信息
+// 流式方法的形式见 ServerStream 和 BidiStream
 // 参数:
 //   - serviceName: 要注册的服务名称。
 //   - port: 服务器监听请求的端口。
@@ -55,7 +99,7 @@ func NewServer(serviceName, port string, server any, heartbeatTimeout time.Durat
 	addr := getLocalIP()
 	if addr == "" {
 		err := fmt.Errorf("cannot get local ip")
-		slog.Error(err.Error())
+		slog.Error("rpc server: " + err.Error())
 		return nil, err
 	}
 	srv := &Server{
@@ -67,62 +111,270 @@ func NewServer(serviceName, port string, server any, heartbeatTimeout time.Durat
 		srv: &http.Server{
 			Addr: port,
 		},
-		cli: &http.Client{},
+		cli:      &http.Client{},
+		builtins: make(map[string]*sync.Map),
+		health:   newHealth(serviceName),
 	}
 	// 注册所有的public方法
-	t := reflect.TypeOf(server)
-	for i := 0; i < t.NumMethod(); i++ {
-		method := t.Method(i)
-		srv.ServiceMap.Store(method.Name, &Method{
-			method:   method,
-			ArgType:  method.Type.In(1),
-			RetType:  method.Type.In(2),
-			Receiver: reflect.ValueOf(server),
-		})
-	}
-	slog.Info(fmt.Sprintf("rpc server: service %s registerd", serviceName))
+	registerMethods(&srv.ServiceMap, server)
+	// 注册内置服务
+	srv.registerBuiltin(HealthServiceName, &healthService{h: srv.health})
+	srv.logger().Info("rpc server: service registered", "service", serviceName)
 	http.HandleFunc("/call", srv.handler)
+	http.HandleFunc("/healthz", srv.healthz)
+	http.HandleFunc("/readyz", srv.readyz)
+	http.HandleFunc("/introspect", srv.introspect)
+	http.HandleFunc(GobStreamPath, srv.gobStream)
+	http.HandleFunc(JSONRPCPath, srv.jsonrpc)
+	http.HandleFunc(OpenAPIPath, srv.openapi)
+	http.HandleFunc(BatchPath, srv.batch)
+	http.HandleFunc(StreamPath, srv.stream)
+	http.HandleFunc(BidiStreamPath, srv.bidi)
+	metrics.HandleDefault()
+	// 没有设置认证器的服务端不做检查，不会影响同一进程中其他服务端的认证
+	metrics.AddDefaultGuard(srv.authenticateMetadata)
 	return srv, nil
 }
 
+// registerMethods 将 receiver 的所有public方法注册到方法表中
+func registerMethods(m *sync.Map, receiver any) {
+	t := reflect.TypeOf(receiver)
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		// 唯一的参数是 BidiStream[Req, Resp] 时为双向流式方法
+		if entry, ok := bidiMethod(method, receiver); ok {
+			m.Store(method.Name, entry)
+			continue
+		}
+		// 第一个参数是 context.Context 时参数和返回值依次后移
+		withContext := method.Type.NumIn() == 4 && method.Type.In(1) == contextType
+		offset := 1
+		if withContext {
+			offset = 2
+		}
+		entry := &Method{
+			method:      method,
+			ArgType:     method.Type.In(offset),
+			RetType:     method.Type.In(offset + 1),
+			Receiver:    reflect.ValueOf(receiver),
+			withContext: withContext,
+		}
+		// 最后一个参数是 ServerStream[T] 时为服务端流式方法
+		if elem, ok := serverStreamElem(entry.RetType); ok {
+			entry.streamType = entry.RetType
+			entry.RetType = elem
+		}
+		m.Store(method.Name, entry)
+	}
+}
+
+// registerBuiltin 注册一个内置服务，内置服务与用户服务共用 /call 接口
+func (s *Server) registerBuiltin(name string, receiver any) {
+	m := &sync.Map{}
+	registerMethods(m, receiver)
+	s.builtins[name] = m
+}
+
+// lookupMethod 根据服务名和方法名查找方法
+// 用户服务和内置服务都从这里查找
+func (s *Server) lookupMethod(service, method string) (*Method, bool) {
+	var methods *sync.Map
+	if service == s.Name {
+		methods = &s.ServiceMap
+	} else if m, ok := s.builtins[service]; ok {
+		methods = m
+	} else {
+		return nil, false
+	}
+	m, ok := methods.Load(method)
+	if !ok {
+		return nil, false
+	}
+	return m.(*Method), true
+}
+
 // handler 处理调用请求
 func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	// 判断是否是一个调用
 	if r.Header.Get("X-Type") != TypeCall {
-		slog.Debug(r.Header.Get("X-Type"))
-		slog.Error("rpc server: wrong message type")
+		s.logger().Error("rpc server: wrong message type", "type", r.Header.Get("X-Type"), "peer", r.RemoteAddr)
 		s.sendErr(w, fmt.Errorf("rpc server: wrong message type"), http.StatusBadRequest)
 		return
 	}
 
+	// 认证
+	ctx, err := s.authenticate(w, r)
+	if err != nil {
+		s.logger().Error("rpc server: authenticate failed", "err", err)
+		s.sendAuthErr(w, err)
+		return
+	}
+
 	// 解析头部
 	header, err := s.parseHeader(r)
 	if err != nil {
-		slog.Error("rpc server: parse header failed", "err", err)
+		s.logger().Error("rpc server: parse header failed", "err", err)
 		s.sendErr(w, err, http.StatusBadRequest)
 		return
 	}
 
 	// 验证请求
 	if err := s.validateReq(header); err != nil {
-		s.sendErr(w, err, http.StatusBadRequest)
+		s.sendErr(w, err, HTTPStatus(CodeOf(err)))
 		return
 	}
 
 	// 创建编解码器
-	cc := codec.NewCodec(header.Option.CodecType)
+	// 请求使用 Content-Type 对应的编解码器，没有 Content-Type 时使用头部中的设置
+	reqType := header.Option.CodecType
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		t, ok := codec.TypeFromMIME(ct)
+		if !ok {
+			s.logger().Error("rpc server: unsupported content type", "content_type", ct)
+			s.sendErr(w, fmt.Errorf("rpc server: unsupported content type %s", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+		reqType = t
+	}
+	cc := codec.NewCodec(reqType)
 	if cc == nil {
-		slog.Error("rpc server: unsupported codec type", "codec type", header.Option.CodecType)
-		s.sendErr(w, fmt.Errorf("rpc server: unsupported codec type %s", header.Option.CodecType), http.StatusBadRequest)
+		s.logger().Error("rpc server: unsupported codec type", "codec", reqType)
+		s.sendErr(w, fmt.Errorf("rpc server: unsupported codec type %s", reqType), http.StatusUnsupportedMediaType)
 		return
 	}
+	// 响应使用客户端接受的编解码器
+	method, _ := s.lookupMethod(header.Service, header.Method)
+	respType, ok := negotiateCodec(r.Header.Get("Accept"), reqType, method.RetType)
+	if !ok {
+		s.logger().Error("rpc server: no acceptable codec", "accept", r.Header.Get("Accept"))
+		s.sendErr(w, fmt.Errorf("rpc server: no acceptable codec in %s", r.Header.Get("Accept")), http.StatusNotAcceptable)
+		return
+	}
+	respCC := cc
+	if respType != reqType {
+		respCC = codec.NewCodec(respType)
+	}
+
+	// 检查方法的参数和返回值是否能被编解码器处理
+	if err := checkMethodTypes(cc, respCC, method); err != nil {
+		s.logger().Error("rpc server: codec does not support method", "method", header.Method, "err", err)
+		s.sendErr(w, fmt.Errorf("rpc server: method %s.%s: %w", header.Service, header.Method, err), http.StatusBadRequest)
+		return
+	}
+
+	// 解压请求体
+	if !s.decompressBody(w, r) {
+		return
+	}
+	defer r.Body.Close()
 
 	// 处理请求
-	if err := s.processReq(w, cc, header, r.Body); err != nil {
-		s.sendErr(w, err, http.StatusInternalServerError)
+	w.Header().Set("Content-Type", codec.MIMEType(respType))
+	if err := s.processReq(ctx, w, cc, respCC, acceptedEncoding(r), header, r.Body); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.sendErr(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.sendErr(w, err, HTTPStatus(CodeOf(err)))
 		return
 	}
+}
 
+// decompressBody 按照 Content-Encoding 解压请求体，解压前后都限制大小
+// 失败时已经发送了错误响应，返回 false
+func (s *Server) decompressBody(w http.ResponseWriter, r *http.Request) bool {
+	if s.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+	}
+	ce := r.Header.Get("Content-Encoding")
+	if ce == "" || ce == "identity" {
+		return true
+	}
+	c := compress.GetCompressor(compress.Type(ce))
+	if c == nil {
+		s.logger().Error("rpc server: unsupported content encoding", "content_encoding", ce)
+		s.sendErr(w, fmt.Errorf("rpc server: unsupported content encoding %s", ce), http.StatusUnsupportedMediaType)
+		return false
+	}
+	body, err := c.NewReader(r.Body)
+	if err != nil {
+		s.logger().Error("rpc server: decompress body failed", "err", err)
+		s.sendErr(w, err, http.StatusBadRequest)
+		return false
+	}
+	r.Body = body
+	if s.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+	}
+	return true
+}
+
+// acceptedEncoding 客户端最优先接受的压缩器，不接受压缩时为空
+func acceptedEncoding(r *http.Request) compress.Type {
+	if encodings := compress.ParseAcceptEncoding(r.Header.Get("Accept-Encoding")); len(encodings) > 0 {
+		return encodings[0]
+	}
+	return ""
+}
+
+// checkMethodTypes 检查方法的参数和返回值类型是否被编解码器支持
+// 参数:
+//   - reqCC: 解码参数的编解码器
+//   - respCC: 编码返回值的编解码器
+//   - method: 方法
+func checkMethodTypes(reqCC, respCC codec.Codec, method *Method) error {
+	if tc, ok := reqCC.(codec.TypeChecker); ok {
+		if err := tc.CheckType(method.ArgType); err != nil {
+			return fmt.Errorf("argument: %w", err)
+		}
+	}
+	if tc, ok := respCC.(codec.TypeChecker); ok {
+		if err := tc.CheckType(method.RetType); err != nil {
+			return fmt.Errorf("reply: %w", err)
+		}
+	}
+	return nil
+}
+
+// negotiateCodec 根据 Accept 头选择响应使用的编解码器
+// 没有 Accept 头或者接受任意类型时使用请求的编解码器
+// 按照优先级跳过不支持返回值类型的编解码器（codec.TypeChecker），
+// 都不支持时返回第一个客户端接受的编解码器，由 checkMethodTypes 给出明确的错误
+// 参数:
+//   - accept: Accept 头
+//   - reqType: 请求使用的编解码器类型
+//   - retType: 方法返回值的类型
+//
+// 返回值:
+//   - codec.Type: 响应使用的编解码器类型
+//   - bool: 是否找到了客户端接受的编解码器
+func negotiateCodec(accept string, reqType codec.Type, retType reflect.Type) (codec.Type, bool) {
+	if accept == "" {
+		return reqType, true
+	}
+	var first codec.Type
+	for _, m := range codec.ParseAccept(accept) {
+		t := reqType
+		if m != "*/*" && m != "application/*" {
+			var ok bool
+			if t, ok = codec.TypeFromMIME(m); !ok {
+				continue
+			}
+		}
+		cc := codec.NewCodec(t)
+		if cc == nil {
+			continue
+		}
+		if tc, ok := cc.(codec.TypeChecker); ok && tc.CheckType(retType) != nil {
+			if first == "" {
+				first = t
+			}
+			continue
+		}
+		return t, true
+	}
+	return first, first != ""
 }
 
 // parseHeader 解析请求头
@@ -153,21 +405,21 @@ func (s *Server) parseHeader(r *http.Request) (*Header, error) {
 func (s *Server) validateReq(header *Header) error {
 	// 验证magic number
 	if header.Option.MagicNumber != MagicNumber {
-		slog.Error("rpc server: invalid magic number", "magic number", header.Option.MagicNumber)
-		return fmt.Errorf("rpc server: invalid magic number %d", header.Option.MagicNumber)
+		s.logger().Error("rpc server: invalid magic number", "magic_number", header.Option.MagicNumber)
+		return Errorf(CodeInvalidArgument, "rpc server: invalid magic number %d", header.Option.MagicNumber)
 	}
 
 	// 确认服务名正确
-	if s.Name != header.Service {
-		slog.Error("rpc server: service name mismatch", s.Name, header.Service)
-		return fmt.Errorf("rpc server: service name mismatch %s", header.Service)
+	if _, ok := s.builtins[header.Service]; s.Name != header.Service && !ok {
+		s.logger().Error("rpc server: service name mismatch", "service", header.Service)
+		return Errorf(CodeNotFound, "rpc server: service name mismatch %s", header.Service)
 	}
 
 	// 确认这个方法存在
-	_, ok := s.ServiceMap.Load(header.Method)
+	_, ok := s.lookupMethod(header.Service, header.Method)
 	if !ok {
-		slog.Error("rpc server: method not found", "method", header.Method)
-		return fmt.Errorf("rpc server: method not found %s", header.Method)
+		s.logger().Error("rpc server: method not found", "service", header.Service, "method", header.Method)
+		return Errorf(CodeNotFound, "rpc server: method not found %s", header.Method)
 	}
 
 	return nil
@@ -175,84 +427,203 @@ func (s *Server) validateReq(header *Header) error {
 
 // processReq 处理请求
 // 参数:
+//   - ctx: 调用的上下文，带有调用方的信息
 //   - w: HTTP 响应写入器
-//   - cc: 编解码器
+//   - cc: 解码请求的编解码器
+//   - respCC: 编码响应的编解码器
+//   - enc: 响应使用的压缩器类型，为空时不压缩
 //   - header: 请求头
 //   - body: 请求体
 //
 // 返回值:
 //   - error: 如果处理失败，则返回错误信息。
-func (s *Server) processReq(w http.ResponseWriter, cc codec.Codec, header *Header, body io.Reader) error {
-	m, ok := s.ServiceMap.Load(header.Method)
+func (s *Server) processReq(ctx context.Context, w http.ResponseWriter, cc, respCC codec.Codec, enc compress.Type, header *Header, body io.Reader) error {
+	method, ok := s.lookupMethod(header.Service, header.Method)
 	if !ok {
-		slog.Error("rpc server: method not found", "method", header.Method)
+		s.logger().Error("rpc server: method not found", "service", header.Service, "method", header.Method)
 		return fmt.Errorf("rpc server: method not found %s", header.Method)
 	}
-	// 获取body
-	bodyBytes, err := io.ReadAll(body)
-	if err != nil {
-		slog.Error("rpc server: read body failed", "err", err)
-		return err
-	}
 	// 解码body
-	method := m.(*Method)
 	req := method.newArgv().Interface()
 	if method.newArgv().Type().Kind() != reflect.Ptr {
 		req = method.newArgv().Addr().Interface()
 	}
-	if err := cc.Decode(bodyBytes, req); err != nil {
-		slog.Error("rpc server: decode body failed", "err", err)
-		return err
+	if err := decodeBody(cc, body, req); err != nil {
+		s.logger().Error("rpc server: decode body failed", "err", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return err
+		}
+		return &Error{Code: CodeInvalidArgument, Message: err.Error()}
 	}
-	slog.Debug("rpc server: request", req)
+	s.logger().Debug("rpc server: request", "service", header.Service, "method", header.Method, "req", req)
 	// 调用方法
-	resp, err := s.call(method, req)
+	resp, err := s.invoke(ctx, header.Service, method, req)
 	if err != nil {
-		slog.Error("rpc server: call method failed", "err", err)
-		s.sendErr(w, err, http.StatusInternalServerError)
 		return err
 	}
 	// 编码结果
-	msg, err := cc.Encode(resp)
+	msg, err := respCC.Encode(resp)
 	if err != nil {
-		slog.Error("rpc server: encode response failed", "err", err)
-		s.sendErr(w, err, http.StatusInternalServerError)
+		s.logger().Error("rpc server: encode response failed", "err", err)
 		return err
 	}
 	// 发送结果
-	s.sendResp(w, msg)
+	s.sendResp(w, msg, enc)
 	return nil
 }
 
+// decodeBody 将消息体解码到 msg 中
+// 编解码器实现了 codec.StreamCodec 时直接从 body 中解码，否则先读取整个 body
+func decodeBody(cc codec.Codec, body io.Reader, msg any) error {
+	if sc, ok := cc.(codec.StreamCodec); ok {
+		return sc.DecodeFrom(body, msg)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return cc.Decode(b, msg)
+}
+
 // sendResp 向 HTTP 响应写入响应信息和状态码200。
-func (s *Server) sendResp(w http.ResponseWriter, msg []byte) {
+// enc 不为空且响应体达到压缩阈值时压缩响应体
+func (s *Server) sendResp(w http.ResponseWriter, msg []byte, enc compress.Type) {
+	threshold := s.CompressThreshold
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if enc != "" && len(msg) >= threshold {
+		compressed, err := compress.Compress(compress.GetCompressor(enc), msg)
+		if err != nil {
+			s.logger().Error("rpc server: compress response failed", "err", err)
+		} else {
+			w.Header().Set("Content-Encoding", string(enc))
+			msg = compressed
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write(msg)
 	if err != nil {
-		slog.Error("rpc server: write response failed", "err", err)
+		s.logger().Error("rpc server: write response failed", "err", err)
 	}
 }
 
 // sendErr 向 HTTP 响应写入错误信息和状态码。
+// 错误码通过 X-Code 头返回，err 不是 *Error 时根据状态码推断
 func (s *Server) sendErr(w http.ResponseWriter, err error, statusCode int) {
+	code := CodeOf(err)
+	if code == CodeUnknown && statusCode != http.StatusInternalServerError {
+		code = codeFromStatus(statusCode)
+	}
+	w.Header().Set("X-Code", string(code))
+	setRetryAfter(w.Header(), err)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(statusCode)
 	_, _ = w.Write([]byte(err.Error()))
 }
 
+// sendAuthErr 返回认证失败的错误
+func (s *Server) sendAuthErr(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		s.sendErr(w, err, http.StatusRequestEntityTooLarge)
+		return
+	}
+	s.sendErr(w, err, HTTPStatus(CodeOf(err)))
+}
+
+// invoke 调用服务的方法
+// 所有的调用入口（/call、JSON-RPC、网关、gob 流）最终都经过这里，在这里记录调用的指标、span 和日志
+// 参数:
+//   - ctx: 调用的上下文，带有调用方的信息
+//   - service: 服务名
+//   - method: 方法
+//   - req: 请求参数
+func (s *Server) invoke(ctx context.Context, service string, method *Method, req any) (resp any, err error) {
+	done := observeCall(serverRequests, serverDuration, serverInFlight, service, method.method.Name)
+	ctx, span := startSpan(ctx, s.Tracer, service+"/"+method.method.Name, SpanKindServer)
+	span.SetAttribute("rpc.system", "gorpc")
+	span.SetAttribute("rpc.service", service)
+	span.SetAttribute("rpc.method", method.method.Name)
+	var peerAddr string
+	if peer, ok := PeerFromContext(ctx); ok {
+		peerAddr = peer.Addr
+		span.SetAttribute("client.address", peerAddr)
+	}
+	defer func() {
+		d := done(err)
+		span.End(err)
+		logCall(s.logger(), s.AccessLog, "rpc server: call", callAttrs(ctx, service, method.method.Name, peerAddr), d, err)
+	}()
+	// 内置服务不需要授权，不受限流、健康状态和并发限制影响
+	if _, builtin := s.builtins[service]; !builtin {
+		if err := s.authorize(ctx, service, method.method.Name); err != nil {
+			return nil, err
+		}
+		if s.RateLimiter != nil {
+			if ok, wait := s.RateLimiter.Allow(ctx, service, method.method.Name); !ok {
+				return nil, &Error{
+					Code:       CodeResourceExhausted,
+					Message:    fmt.Sprintf("rpc server: rate limit exceeded for %s.%s", service, method.method.Name),
+					RetryAfter: wait,
+				}
+			}
+		}
+		// 服务不可用时拒绝调用
+		if !s.health.accepting(service) {
+			return nil, Errorf(CodeUnavailable, "rpc server: service %s is not serving", service)
+		}
+		if s.ConcurrencyLimiter != nil {
+			release, err := s.ConcurrencyLimiter.Acquire(ctx, service, method.method.Name)
+			if err != nil {
+				return nil, err
+			}
+			start := time.Now()
+			defer func() {
+				// 流的持续时间取决于调用方，不参与自适应调整
+				if method.streamType != nil || method.bidi {
+					release(-1)
+					return
+				}
+				release(time.Since(start))
+			}()
+		}
+	}
+	return s.call(ctx, method, req)
+}
+
 // call 调用方法
 // 参数:
+//   - ctx: 方法需要 context.Context 时传入
 //   - method: 方法
 //   - req: 请求参数
-func (s *Server) call(method *Method, req any) (any, error) {
-	// 校验参数类型
-	if reflect.TypeOf(req) != method.ArgType {
-		slog.Error("rpc server: request type mismatch", "type of req", reflect.TypeOf(req), "type of arg", method.ArgType)
+func (s *Server) call(ctx context.Context, method *Method, req any) (any, error) {
+	// 双向流式方法没有参数，消息都在流中
+	if method.bidi {
+		return nil, s.callBidi(ctx, method)
+	}
+	// 校验参数类型，参数不是指针类型时解码得到的是指向它的指针
+	argv := reflect.ValueOf(req)
+	if argv.Type() != method.ArgType && argv.Kind() == reflect.Ptr && argv.Type().Elem() == method.ArgType {
+		argv = argv.Elem()
+	}
+	if argv.Type() != method.ArgType {
+		s.logger().Error("rpc server: request type mismatch", "req_type", reflect.TypeOf(req), "arg_type", method.ArgType)
 		return nil, fmt.Errorf("rpc server: request type mismatch %s", reflect.TypeOf(req))
 	}
+	if method.streamType != nil {
+		return nil, s.callStream(ctx, method, argv)
+	}
 	f := method.method.Func
 	ret := method.newRetv()
 	// 实际的调用
-	errRet := f.Call([]reflect.Value{method.Receiver, reflect.ValueOf(req), ret})
+	args := []reflect.Value{method.Receiver, argv, ret}
+	if method.withContext {
+		args = []reflect.Value{method.Receiver, reflect.ValueOf(ctx), argv, ret}
+	}
+	errRet := f.Call(args)
 	if len(errRet) == 0 {
 		return nil, fmt.Errorf("rpc server: no return value")
 	}
@@ -263,8 +634,13 @@ func (s *Server) call(method *Method, req any) (any, error) {
 }
 
 // Run 启动服务器
+// 设置了 TLSConfig 时使用 HTTPS
 func (s *Server) Run() error {
-	slog.Info("rpc server: Running")
+	s.logger().Info("rpc server: Running")
+	if s.TLSConfig != nil {
+		s.srv.TLSConfig = s.TLSConfig
+		return s.srv.ListenAndServeTLS("", "")
+	}
 	return s.srv.ListenAndServe()
 }
 
@@ -272,6 +648,11 @@ func (s *Server) Run() error {
 // 参数:
 //   - registryAddr: 注册中心地址
 func (s *Server) RunWithRegistry(registryAddr string) error {
+	if s.RegistryTLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = s.RegistryTLSConfig.Clone()
+		s.cli.Transport = transport
+	}
 	s.register(registryAddr, s.HeartBeatTimeout)
 	go s.heartBeat(registryAddr, s.HeartBeatTimeout)
 	return s.Run()
@@ -286,21 +667,23 @@ func (s *Server) register(registryAddr string, timeout time.Duration) {
 		Name:    s.Name,
 		Addr:    s.Addr + s.Port,
 		Timeout: timeout,
+		Status:  s.health.registryStatus(),
+		Scheme:  schemeOf(s.TLSConfig),
 	}
 	body, err := json.Marshal(service)
 	if err != nil {
-		slog.Error("rpc server: marshal service info failed", "err", err)
+		s.logger().Error("rpc server: marshal service info failed", "err", err)
 		return
 	}
 	req, err := http.NewRequest("POST", registryAddr+"/register", bytes.NewBuffer(body))
 	if err != nil {
-		slog.Error("rpc server: new request failed", "err", err)
+		s.logger().Error("rpc server: new request failed", "err", err)
 		return
 	}
 	req.Header.Set("X-Type", TypeRegister)
 	resp, err := s.cli.Do(req)
 	if err != nil {
-		slog.Error("rpc server: send request failed", "err", err)
+		s.logger().Error("rpc server: send request failed", "err", err)
 		return
 	}
 	defer resp.Body.Close()
@@ -308,36 +691,44 @@ func (s *Server) register(registryAddr string, timeout time.Duration) {
 
 // heartBeat 发送心跳
 // 每隔一段时间向注册中心发送心跳
+// 健康状态发生变化时会立即发送一次，使注册中心尽快感知
 // 并非发送一次心跳的函数，而是一个loop
 // 参数:
 //   - registryAddr: 注册中心地址
 //   - timeout: 心跳间隔
 func (s *Server) heartBeat(registryAddr string, timeout time.Duration) {
-	info := ServiceInfo{
-		Name:    s.Name,
-		Addr:    s.Addr + s.Port,
-		Timeout: s.HeartBeatTimeout,
-	}
-	b, err := json.Marshal(info)
-	if err != nil {
-		slog.Error("rpc server: marshal failed", "err", err)
-		return
-	}
-
+	ticker := time.NewTicker(timeout)
+	defer ticker.Stop()
 	for {
-		time.Sleep(timeout)
+		select {
+		case <-ticker.C:
+		case <-s.health.changed:
+		}
+		info := ServiceInfo{
+			Name:    s.Name,
+			Addr:    s.Addr + s.Port,
+			Timeout: s.HeartBeatTimeout,
+			Status:  s.health.registryStatus(),
+			Scheme:  schemeOf(s.TLSConfig),
+		}
+		b, err := json.Marshal(info)
+		if err != nil {
+			s.logger().Error("rpc server: marshal failed", "err", err)
+			return
+		}
 		req, err := http.NewRequest("POST", registryAddr+"/heartbeat", bytes.NewBuffer(b))
 		if err != nil {
-			slog.Error("rpc server: new request failed", "err", err)
+			s.logger().Error("rpc server: new request failed", "err", err)
 			return
 		}
 		req.Header.Set("X-Type", TypePing)
 
-		_, err = s.cli.Do(req)
+		resp, err := s.cli.Do(req)
 		if err != nil {
-			slog.Error("rpc server: send request failed", "err", err)
+			s.logger().Error("rpc server: send request failed", "err", err)
 			continue
 		}
+		resp.Body.Close()
 	}
 }
 
@@ -0,0 +1,378 @@
+package gorpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+	"github.com/wifi32767/HTTPGoRpc/compress"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// 测试共用的服务端
+// NewServer 在默认的 ServeMux 上注册处理函数，一个进程中只能创建一次
+
+const testServiceName = "Test"
+
+type testArgs struct {
+	A, B int
+	Name string
+}
+
+type testReply struct {
+	Sum  int
+	Name string
+}
+
+type testService struct{}
+
+func (t *testService) Add(args *testArgs, reply *testReply) error {
+	reply.Sum = args.A + args.B
+	reply.Name = args.Name
+	return nil
+}
+
+// Upper 参数和返回值都是 proto.Message，可以使用 proto 编解码器调用
+func (t *testService) Upper(args *wrapperspb.StringValue, reply *wrapperspb.StringValue) error {
+	reply.Value = strings.ToUpper(args.Value)
+	return nil
+}
+
+// Fail 返回以 Name 为信息的错误，信息可以为空
+func (t *testService) Fail(args *testArgs, reply *testReply) error {
+	return errors.New(args.Name)
+}
+
+// Whoami 返回调用方经过验证的身份
+func (t *testService) Whoami(ctx context.Context, args *testArgs, reply *testReply) error {
+	if peer, ok := PeerFromContext(ctx); ok {
+		reply.Name = peer.Identity()
+	}
+	return nil
+}
+
+// Count 依次发送 Sum 为 0 到 A-1 的返回值，A 为负数时一直发送到客户端断开
+// Name 不为空时发送完之后返回以 Name 为信息的错误
+func (t *testService) Count(args *testArgs, stream ServerStream[testReply]) error {
+	for i := 0; args.A < 0 || i < args.A; i++ {
+		if err := stream.Send(&testReply{Sum: i}); err != nil {
+			// 通知测试客户端已经断开
+			select {
+			case testCountAborted <- struct{}{}:
+			default:
+			}
+			return err
+		}
+	}
+	if args.Name != "" {
+		return errors.New(args.Name)
+	}
+	return nil
+}
+
+var (
+	// Count 因为客户端断开而停止时收到一个值
+	testCountAborted = make(chan struct{}, 1)
+
+	testServerOnce sync.Once
+	testSrv        *Server
+	testAddr       string
+	// 服务端连接上读写的总字节数
+	testWireBytes atomic.Int64
+)
+
+// startTestServer 启动测试共用的服务端，返回服务端和地址
+// 请求体限制为 1MiB
+func startTestServer(tb testing.TB) (*Server, string) {
+	tb.Helper()
+	testServerOnce.Do(func() {
+		s, err := NewServer(testServiceName, ":0", &testService{}, time.Minute)
+		if err != nil {
+			tb.Fatalf("NewServer: %v", err)
+		}
+		s.MaxBodySize = 1 << 20
+		s.Logger = discardLogger()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			tb.Fatalf("listen: %v", err)
+		}
+		go http.Serve(countingListener{ln}, nil)
+		testSrv, testAddr = s, ln.Addr().String()
+	})
+	if testSrv == nil {
+		tb.Fatal("test server failed to start")
+	}
+	return testSrv, testAddr
+}
+
+// discardLogger 丢弃所有日志，避免测试输出中出现预期内的错误日志
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// countingListener 统计所有连接读写的字节数
+type countingListener struct {
+	net.Listener
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn}, nil
+}
+
+type countingConn struct {
+	net.Conn
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	testWireBytes.Add(int64(n))
+	return n, err
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	testWireBytes.Add(int64(n))
+	return n, err
+}
+
+// postCall 不经过客户端直接向 /call 发送请求，用于构造客户端不会发出的请求
+// header 中设置请求头，body 按原样发送
+func postCall(t *testing.T, addr, method string, header http.Header, body io.Reader) *http.Response {
+	t.Helper()
+	opt := *DefaultOptions
+	opt.CodecType = codec.TypeJson
+	h, err := json.Marshal(&Header{Service: testServiceName, Method: method, Option: opt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "http://"+addr+"/call", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Type", TypeCall)
+	req.Header.Set("X-Header", string(h))
+	req.Header.Set("Content-Type", codec.MIMEType(codec.TypeJson))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestCallRejectsTrailingData(t *testing.T) {
+	_, addr := startTestServer(t)
+	resp := postCall(t, addr, "Add", nil, strings.NewReader(`{"A":1,"B":2}`+"\n"))
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d: %s", resp.StatusCode, b)
+	}
+	var reply testReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil || reply.Sum != 3 {
+		t.Fatalf("reply = %+v, %v", reply, err)
+	}
+
+	resp = postCall(t, addr, "Add", nil, strings.NewReader(`{"A":1,"B":2}{"A":3}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+	if code := resp.Header.Get("X-Code"); code != string(CodeInvalidArgument) {
+		t.Errorf("X-Code = %q", code)
+	}
+}
+
+func TestCallBodyTooLarge(t *testing.T) {
+	s, addr := startTestServer(t)
+	// 合法的 JSON，只是字符串超过了 MaxBodySize
+	body := `{"Name":"` + strings.Repeat("a", int(s.MaxBodySize)) + `"}`
+	resp := postCall(t, addr, "Add", nil, strings.NewReader(body))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestCallUnsupportedContentType(t *testing.T) {
+	_, addr := startTestServer(t)
+	resp := postCall(t, addr, "Add", http.Header{"Content-Type": {"text/plain"}}, strings.NewReader(`{}`))
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d, want 415", resp.StatusCode)
+	}
+}
+
+func TestCallNotAcceptable(t *testing.T) {
+	_, addr := startTestServer(t)
+	resp := postCall(t, addr, "Add", http.Header{"Accept": {"text/html, application/json;q=0"}}, strings.NewReader(`{}`))
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("status = %d, want 406", resp.StatusCode)
+	}
+}
+
+// 请求使用 JSON，响应使用 Accept 中的 msgpack
+func TestCallAlternateCodec(t *testing.T) {
+	_, addr := startTestServer(t)
+	resp := postCall(t, addr, "Add", http.Header{"Accept": {"application/msgpack, application/json;q=0.5"}}, strings.NewReader(`{"A":1,"B":2}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != codec.MIMEType(codec.TypeMsgpack) {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply testReply
+	if err := codec.NewCodec(codec.TypeMsgpack).Decode(b, &reply); err != nil || reply.Sum != 3 {
+		t.Fatalf("reply = %+v, %v", reply, err)
+	}
+
+	// 客户端按照响应的 Content-Type 解码
+	cli := NewClient(addr, &Options{CodecType: codec.TypeJson, Accept: []codec.Type{codec.TypeCBOR}})
+	reply = testReply{}
+	if err := cli.Call(context.Background(), testServiceName, "Add", &testArgs{A: 2, B: 3}, &reply); err != nil || reply.Sum != 5 {
+		t.Fatalf("reply = %+v, %v", reply, err)
+	}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	s, _ := startTestServer(t)
+	add, _ := s.lookupMethod(testServiceName, "Add")
+	upper, _ := s.lookupMethod(testServiceName, "Upper")
+	tests := []struct {
+		name    string
+		accept  string
+		reqType codec.Type
+		method  *Method
+		want    codec.Type
+		wantOK  bool
+	}{
+		{"no accept", "", codec.TypeJson, add, codec.TypeJson, true},
+		{"wildcard", "*/*", codec.TypeGob, add, codec.TypeGob, true},
+		{"q order", "application/json;q=0.5, application/cbor", codec.TypeGob, add, codec.TypeCBOR, true},
+		{"unknown", "text/html", codec.TypeJson, add, "", false},
+		{"proto supports reply", "application/x-protobuf, application/json", codec.TypeJson, upper, codec.TypeProto, true},
+		// proto 不支持 testReply，退回到下一个接受的编解码器
+		{"skip rejecting codec", "application/x-protobuf, application/json;q=0.5", codec.TypeJson, add, codec.TypeJson, true},
+		{"skip to wildcard", "application/x-protobuf, */*;q=0.1", codec.TypeJson, add, codec.TypeJson, true},
+		// 都不支持时返回第一个，由 checkMethodTypes 报错
+		{"none supports reply", "application/x-protobuf", codec.TypeJson, add, codec.TypeProto, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := negotiateCodec(tt.accept, tt.reqType, tt.method.RetType)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("negotiateCodec(%q) = %q, %v, want %q, %v", tt.accept, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// 客户端优先接受 proto，方法的返回值不是 proto.Message 时服务端退回到 JSON
+func TestCallFallsBackFromRejectingCodec(t *testing.T) {
+	_, addr := startTestServer(t)
+	resp := postCall(t, addr, "Add", http.Header{"Accept": {"application/x-protobuf, application/json;q=0.5"}}, strings.NewReader(`{"A":1,"B":2}`))
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d: %s", resp.StatusCode, b)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != codec.MIMEType(codec.TypeJson) {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+}
+
+// 请求体按照 Content-Encoding 解压，响应体达到 CompressThreshold 才压缩
+func TestCallCompression(t *testing.T) {
+	s, addr := startTestServer(t)
+	gzip := compress.GetCompressor(compress.TypeGzip)
+	tests := []struct {
+		name     string
+		size     int
+		wantGzip bool
+	}{
+		{"below threshold", DefaultCompressThreshold / 2, false},
+		{"above threshold", DefaultCompressThreshold * 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := strings.Repeat("a", tt.size)
+			body, err := compress.Compress(gzip, []byte(`{"A":1,"B":2,"Name":"`+name+`"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := postCall(t, addr, "Add", http.Header{
+				"Content-Encoding": {"gzip"},
+				"Accept-Encoding":  {"zstd;q=0, gzip"},
+			}, bytes.NewReader(body))
+			if resp.StatusCode != http.StatusOK {
+				b, _ := io.ReadAll(resp.Body)
+				t.Fatalf("status = %d: %s", resp.StatusCode, b)
+			}
+			if got := resp.Header.Get("Content-Encoding") == "gzip"; got != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q", resp.Header.Get("Content-Encoding"))
+			}
+			var r io.Reader = resp.Body
+			if tt.wantGzip {
+				rc, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rc.Close()
+				r = rc
+			}
+			var reply testReply
+			if err := json.NewDecoder(r).Decode(&reply); err != nil || reply.Sum != 3 || reply.Name != name {
+				t.Fatalf("reply.Sum = %d, len(reply.Name) = %d, %v", reply.Sum, len(reply.Name), err)
+			}
+		})
+	}
+
+	// 解压后超过 MaxBodySize 同样返回413
+	t.Run("decompressed too large", func(t *testing.T) {
+		body, err := compress.Compress(gzip, []byte(`{"Name":"`+strings.Repeat("a", int(s.MaxBodySize))+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := postCall(t, addr, "Add", http.Header{"Content-Encoding": {"gzip"}}, bytes.NewReader(body))
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("status = %d, want 413", resp.StatusCode)
+		}
+	})
+
+	t.Run("unknown encoding", func(t *testing.T) {
+		resp := postCall(t, addr, "Add", http.Header{"Content-Encoding": {"br"}}, strings.NewReader(`{}`))
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Fatalf("status = %d, want 415", resp.StatusCode)
+		}
+	})
+
+	// 客户端压缩请求并解压响应
+	t.Run("client", func(t *testing.T) {
+		cli := NewClient(addr, &Options{CodecType: codec.TypeJson, Compression: compress.TypeZstd})
+		name := strings.Repeat("b", DefaultCompressThreshold*4)
+		var reply testReply
+		if err := cli.Call(context.Background(), testServiceName, "Add", &testArgs{A: 1, B: 1, Name: name}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.Sum != 2 || reply.Name != name {
+			t.Fatalf("reply.Sum = %d, len(reply.Name) = %d", reply.Sum, len(reply.Name))
+		}
+	})
+}
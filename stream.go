@@ -0,0 +1,422 @@
+package gorpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+// 服务端流式调用
+// 方法的形式为 func(req *Req, stream gorpc.ServerStream[Resp]) error，也可以在最前面加上 ctx context.Context
+// 客户端发送一个请求，服务端通过 stream.Send 发送任意多个返回值
+// 响应使用 HTTP 分块传输，由一个个帧组成，每个帧为1字节的类型、4字节大端序的长度和内容
+// 返回值帧的内容使用请求的编解码器编码，最后一帧是 JSON 格式的结束帧，带有方法返回的错误
+
+const (
+	StreamPath        = "/stream"
+	StreamContentType = "application/x-gorpc-stream"
+)
+
+// 帧的类型
+const (
+	frameMessage   byte = iota // 一个消息
+	frameEnd                   // 流结束，内容为 streamTrailer
+	frameCloseSend             // 客户端不再发送消息，只用于双向流
+	frameWindow                // 允许对方再发送的消息数，内容为4字节大端序的整数，只用于双向流
+)
+
+// streamTrailer 结束帧的内容
+type streamTrailer struct {
+	Error      string        `json:"error,omitempty"` // 为空表示方法成功返回
+	Code       Code          `json:"code,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+}
+
+// writeFrame 写入一个帧
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	var h [5]byte
+	h[0] = typ
+	binary.BigEndian.PutUint32(h[1:], uint32(len(payload)))
+	if _, err := w.Write(h[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame 读取一个帧，maxSize 大于0时限制帧的长度
+func readFrame(r io.Reader, maxSize int64) (byte, []byte, error) {
+	var h [5]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(h[1:])
+	if maxSize > 0 && int64(n) > maxSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds the limit of %d", n, maxSize)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return h[0], payload, nil
+}
+
+// ServerStream 服务端流式方法用来发送返回值
+// 只在方法返回之前有效，可以被多个协程同时使用
+type ServerStream[T any] struct {
+	s *serverStream
+}
+
+// Send 发送一个返回值
+// 客户端断开或者调用的上下文结束时返回错误，此时方法应该尽快返回
+// 方法返回之后流已经结束，再调用 Send 总是返回错误
+func (s ServerStream[T]) Send(msg *T) error {
+	return s.s.send(msg)
+}
+
+// Context 调用的上下文，带有调用方的信息和 span
+func (s ServerStream[T]) Context() context.Context {
+	return s.s.ctx
+}
+
+// rawServerStream 与所有的 ServerStream[T] 有相同的底层类型，用于通过反射创建 ServerStream[T]
+type rawServerStream struct {
+	s *serverStream
+}
+
+var rawServerStreamType = reflect.TypeOf(rawServerStream{})
+
+// serverStreamElem 判断参数是否为 ServerStream[T]，是时返回 Send 的参数类型 *T
+func serverStreamElem(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() != reflect.Struct || t.PkgPath() != rawServerStreamType.PkgPath() ||
+		!strings.HasPrefix(t.Name(), "ServerStream[") || !rawServerStreamType.ConvertibleTo(t) {
+		return nil, false
+	}
+	send, ok := t.MethodByName("Send")
+	if !ok {
+		return nil, false
+	}
+	return send.Type.In(1), true
+}
+
+type serverStreamKey struct{}
+
+// errStreamFinished 方法返回、流已经结束之后再发送时的错误
+var errStreamFinished = errors.New("rpc server: stream finished")
+
+// serverStream 一次服务端流式调用的响应
+type serverStream struct {
+	mutex   sync.Mutex
+	ctx     context.Context
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	cc      codec.Codec
+	started bool  // 是否已经发送了响应头
+	err     error // 不为 nil 时不能再发送，流结束之后为 errStreamFinished
+}
+
+// start 发送响应头，需要持有锁
+func (ss *serverStream) start() {
+	if ss.started {
+		return
+	}
+	ss.started = true
+	ss.w.Header().Set("Content-Type", StreamContentType)
+	ss.w.WriteHeader(http.StatusOK)
+}
+
+func (ss *serverStream) send(msg any) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if ss.err != nil {
+		return ss.err
+	}
+	if err := ss.ctx.Err(); err != nil {
+		return err
+	}
+	b, err := ss.cc.Encode(msg)
+	if err != nil {
+		return err
+	}
+	ss.start()
+	if err := writeFrame(ss.w, frameMessage, b); err != nil {
+		ss.err = err
+		return err
+	}
+	if err := ss.rc.Flush(); err != nil {
+		ss.err = err
+		return err
+	}
+	return nil
+}
+
+// finish 方法返回后结束流
+// 还没有发送过返回值时，错误作为普通的错误响应发送，这样调用前被拒绝的请求有正确的状态码
+func (ss *serverStream) finish(s *Server, callErr error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	// 无论是否成功写入结尾，之后的 send 都返回 errStreamFinished，
+	// 而不是在方法返回之后继续使用已经结束的 ResponseWriter
+	defer func() {
+		ss.err = errStreamFinished
+	}()
+	if ss.err != nil {
+		return
+	}
+	if !ss.started && callErr != nil {
+		s.sendErr(ss.w, callErr, HTTPStatus(CodeOf(callErr)))
+		return
+	}
+	ss.start()
+	var trailer streamTrailer
+	if callErr != nil {
+		trailer = streamTrailer{Error: callErr.Error(), Code: CodeOf(callErr), RetryAfter: RetryAfterOf(callErr)}
+	}
+	b, err := json.Marshal(trailer)
+	if err != nil {
+		s.logger().Error("rpc server: marshal stream trailer failed", "err", err)
+		return
+	}
+	if err := writeFrame(ss.w, frameEnd, b); err != nil {
+		s.logger().Error("rpc server: write stream trailer failed", "err", err)
+		return
+	}
+	_ = ss.rc.Flush()
+}
+
+// stream 处理服务端流式调用
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Type") != TypeStream {
+		s.logger().Error("rpc server: wrong message type", "type", r.Header.Get("X-Type"), "peer", r.RemoteAddr)
+		s.sendErr(w, fmt.Errorf("rpc server: wrong message type"), http.StatusBadRequest)
+		return
+	}
+	ctx, err := s.authenticate(w, r)
+	if err != nil {
+		s.logger().Error("rpc server: authenticate failed", "err", err)
+		s.sendAuthErr(w, err)
+		return
+	}
+	header, err := s.parseHeader(r)
+	if err != nil {
+		s.logger().Error("rpc server: parse header failed", "err", err)
+		s.sendErr(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := s.validateReq(header); err != nil {
+		s.sendErr(w, err, HTTPStatus(CodeOf(err)))
+		return
+	}
+	method, _ := s.lookupMethod(header.Service, header.Method)
+	if method.streamType == nil || method.bidi {
+		s.sendErr(w, Errorf(CodeInvalidArgument, "rpc server: %s.%s is not a server streaming method", header.Service, header.Method), http.StatusBadRequest)
+		return
+	}
+	// 请求和返回值都使用请求的编解码器
+	reqType := header.Option.CodecType
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		t, ok := codec.TypeFromMIME(ct)
+		if !ok {
+			s.sendErr(w, fmt.Errorf("rpc server: unsupported content type %s", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+		reqType = t
+	}
+	cc := codec.NewCodec(reqType)
+	if cc == nil {
+		s.sendErr(w, fmt.Errorf("rpc server: unsupported codec type %s", reqType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err := checkMethodTypes(cc, cc, method); err != nil {
+		s.sendErr(w, fmt.Errorf("rpc server: method %s.%s: %w", header.Service, header.Method, err), http.StatusBadRequest)
+		return
+	}
+	if !s.decompressBody(w, r) {
+		return
+	}
+	defer r.Body.Close()
+
+	argv := method.newArgv()
+	arg := argv.Interface()
+	if argv.Kind() != reflect.Ptr {
+		arg = argv.Addr().Interface()
+	}
+	if err := decodeBody(cc, r.Body, arg); err != nil {
+		s.logger().Error("rpc server: decode body failed", "err", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.sendErr(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.sendErr(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ss := &serverStream{ctx: ctx, w: w, rc: http.NewResponseController(w), cc: cc}
+	_, err = s.invoke(context.WithValue(ctx, serverStreamKey{}, ss), header.Service, method, arg)
+	ss.finish(s, err)
+}
+
+// callStream 通过反射调用服务端流式方法，流在 ctx 中
+func (s *Server) callStream(ctx context.Context, method *Method, argv reflect.Value) error {
+	ss, ok := ctx.Value(serverStreamKey{}).(*serverStream)
+	if !ok {
+		return Errorf(CodeInvalidArgument, "rpc server: %s is a streaming method, call it through %s", method.method.Name, StreamPath)
+	}
+	ss.mutex.Lock()
+	ss.ctx = ctx
+	ss.mutex.Unlock()
+	stream := reflect.ValueOf(rawServerStream{s: ss}).Convert(method.streamType)
+	args := []reflect.Value{method.Receiver, argv, stream}
+	if method.withContext {
+		args = []reflect.Value{method.Receiver, reflect.ValueOf(ctx), argv, stream}
+	}
+	errRet := method.method.Func.Call(args)
+	if len(errRet) == 0 {
+		return fmt.Errorf("rpc server: no return value")
+	}
+	if err, _ := errRet[0].Interface().(error); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CallStream 调用服务端流式方法，返回一个依次产生返回值的迭代器
+// 迭代开始时才发送请求，提前结束迭代或者 ctx 结束时关闭连接
+// 调用失败时最后产生一次 (nil, err)
+// 参数:
+//   - ctx: 上下文
+//   - c: 客户端
+//   - service: 服务名
+//   - method: 方法名
+//   - arg: 参数
+//
+// 返回值:
+//   - iter.Seq2[*Resp, error]: 返回值的迭代器
+func CallStream[Resp any](ctx context.Context, c *Client, service, method string, arg any) iter.Seq2[*Resp, error] {
+	return func(yield func(*Resp, error) bool) {
+		stopped := false
+		err := c.callStream(ctx, service, method, arg, func() any { return new(Resp) }, func(msg any) bool {
+			if !yield(msg.(*Resp), nil) {
+				stopped = true
+			}
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+// callStream 发送服务端流式调用的请求，对每个返回值调用 each，each 返回 false 时停止
+// 参数:
+//   - ctx: 上下文
+//   - service: 服务名
+//   - method: 方法名
+//   - arg: 参数
+//   - newMsg: 创建一个接收返回值的指针
+//   - each: 处理一个返回值
+//
+// 返回值:
+//   - error: 调用失败时的错误，each 停止时为 nil
+func (c *Client) callStream(ctx context.Context, service, method string, arg any, newMsg func() any, each func(msg any) bool) (err error) {
+	ctx = ensureRequestID(ctx)
+	addr := c.TargetAddr
+	if c.Opt.UseRegistry {
+		addr, err = c.getAddr(service)
+		if err != nil {
+			c.logger().Error("rpc client: get addr failed", "err", err)
+			return err
+		}
+	}
+	done := observeCall(clientRequests, clientDuration, clientInFlight, service, method)
+	ctx, span := startSpan(ctx, c.Opt.Tracer, service+"/"+method, SpanKindClient)
+	span.SetAttribute("rpc.system", "gorpc")
+	span.SetAttribute("rpc.service", service)
+	span.SetAttribute("rpc.method", method)
+	span.SetAttribute("server.address", addr)
+	defer func() {
+		d := done(err)
+		span.End(err)
+		logCall(c.logger(), c.Opt.AccessLog, "rpc client: stream", callAttrs(ctx, service, method, addr), d, err)
+	}()
+	// 停止迭代时取消请求，关闭连接
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	header, err := json.Marshal(Header{Service: service, Method: method, Option: c.Opt})
+	if err != nil {
+		return err
+	}
+	body, err := c.cc.Encode(arg)
+	if err != nil {
+		return err
+	}
+	resp, err := c.sendReq(ctx, TypeStream, addr, StreamPath, codec.MIMEType(c.Opt.CodecType), header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, err := c.responseBody(resp)
+		if err != nil {
+			return err
+		}
+		defer respBody.Close()
+		b, err := io.ReadAll(respBody)
+		if err != nil {
+			return err
+		}
+		return responseError(resp, b)
+	}
+
+	br := bufio.NewReader(resp.Body)
+	for {
+		typ, payload, err := readFrame(br, c.Opt.MaxBodySize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("rpc client: read stream failed: %w", err)
+		}
+		switch typ {
+		case frameMessage:
+			msg := newMsg()
+			if err := c.cc.Decode(payload, msg); err != nil {
+				return fmt.Errorf("rpc client: decode stream message failed: %w", err)
+			}
+			if !each(msg) {
+				return nil
+			}
+		case frameEnd:
+			var trailer streamTrailer
+			if err := json.Unmarshal(payload, &trailer); err != nil {
+				return fmt.Errorf("rpc client: decode stream trailer failed: %w", err)
+			}
+			if trailer.Error != "" {
+				return &Error{Code: trailer.Code, Message: trailer.Error, RetryAfter: trailer.RetryAfter}
+			}
+			return nil
+		default:
+			return fmt.Errorf("rpc client: unknown stream frame type %d", typ)
+		}
+	}
+}
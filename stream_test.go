@@ -0,0 +1,58 @@
+package gorpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+func newTestServerStream() (*serverStream, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	return &serverStream{
+		ctx: context.Background(),
+		w:   rec,
+		rc:  http.NewResponseController(rec),
+		cc:  codec.NewCodec(codec.TypeJson),
+	}, rec
+}
+
+// 流结束之后的发送总是失败，不会再写入响应
+func TestServerStreamSendAfterFinish(t *testing.T) {
+	s := &Server{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	tests := []struct {
+		name    string
+		sendErr bool // 结束前是否已经发送过返回值
+		callErr error
+	}{
+		{"ok", true, nil},
+		{"error after send", true, Errorf(CodeInternal, "boom")},
+		{"error before send", false, Errorf(CodeInvalidArgument, "bad")},
+		{"no messages", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss, rec := newTestServerStream()
+			if tt.sendErr {
+				if err := ss.send(&testReply{Sum: 1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ss.finish(s, tt.callErr)
+			n := rec.Body.Len()
+			for i := 0; i < 2; i++ {
+				if err := ss.send(&testReply{Sum: 2}); !errors.Is(err, errStreamFinished) {
+					t.Fatalf("send after finish: %v, want %v", err, errStreamFinished)
+				}
+			}
+			if rec.Body.Len() != n {
+				t.Fatal("send after finish wrote to the response")
+			}
+		})
+	}
+}
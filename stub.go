@@ -0,0 +1,89 @@
+package gorpc
+
+import (
+	"context"
+	"iter"
+)
+
+// MethodStub 类型化的方法调用，参数和返回值的类型在编译期检查
+// 创建之后可以被多个协程同时使用
+type MethodStub[Req, Resp any] struct {
+	client  *Client
+	service string
+	method  string
+}
+
+// NewMethod 创建一个类型化的方法调用
+// Req 和 Resp 应当与服务端方法的参数类型和返回值的元素类型一致，例如服务端方法为
+// Fun1(req *Req, resp *Resp) error 时使用 NewMethod[*Req, Resp]
+// 参数:
+//   - c: 客户端
+//   - service: 服务名
+//   - method: 方法名
+//
+// 返回值:
+//   - *MethodStub[Req, Resp]: 类型化的方法调用
+func NewMethod[Req, Resp any](c *Client, service, method string) *MethodStub[Req, Resp] {
+	return &MethodStub[Req, Resp]{
+		client:  c,
+		service: service,
+		method:  method,
+	}
+}
+
+// Service 服务名
+func (m *MethodStub[Req, Resp]) Service() string {
+	return m.service
+}
+
+// Method 方法名
+func (m *MethodStub[Req, Resp]) Method() string {
+	return m.method
+}
+
+// Call 同步调用
+func (m *MethodStub[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	var resp Resp
+	err := m.client.Call(ctx, m.service, m.method, req, &resp)
+	return resp, err
+}
+
+// Go 异步调用，通过返回的 Future 获取结果
+func (m *MethodStub[Req, Resp]) Go(ctx context.Context, req Req) *Future[Resp] {
+	f := &Future[Resp]{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		f.val, f.err = m.Call(ctx, req)
+	}()
+	return f
+}
+
+// Stream 调用服务端流式方法，返回依次产生返回值的迭代器
+// 服务端方法为 Fun1(req *Req, stream gorpc.ServerStream[Resp]) error 时使用 NewMethod[*Req, Resp]
+func (m *MethodStub[Req, Resp]) Stream(ctx context.Context, req Req) iter.Seq2[*Resp, error] {
+	return CallStream[Resp](ctx, m.client, m.service, m.method, req)
+}
+
+// Open 打开到双向流式方法的流
+// 服务端方法为 Fun3(stream gorpc.BidiStream[Req, Resp]) error 时使用 NewMethod[*Req, Resp]
+func (m *MethodStub[Req, Resp]) Open(ctx context.Context) (*Stream, error) {
+	return m.client.Stream(ctx, m.service, m.method)
+}
+
+// Future 异步调用的结果
+type Future[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// Done 调用结束时关闭的通道，可以在 select 中使用
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait 等待调用结束并返回结果，可以多次调用
+func (f *Future[T]) Wait() (T, error) {
+	<-f.done
+	return f.val, f.err
+}
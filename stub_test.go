@@ -0,0 +1,121 @@
+package gorpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+func newTestStubClient(t *testing.T) *Client {
+	_, addr := startTestServer(t)
+	return NewClient(addr, &Options{CodecType: codec.TypeJson, Logger: discardLogger()})
+}
+
+func TestMethodStubCall(t *testing.T) {
+	cli := newTestStubClient(t)
+	add := NewMethod[*testArgs, testReply](cli, testServiceName, "Add")
+	if add.Service() != testServiceName || add.Method() != "Add" {
+		t.Fatalf("stub = %s.%s", add.Service(), add.Method())
+	}
+	reply, err := add.Call(context.Background(), &testArgs{A: 1, B: 2, Name: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Sum != 3 || reply.Name != "x" {
+		t.Fatalf("reply = %+v", reply)
+	}
+
+	fail := NewMethod[*testArgs, testReply](cli, testServiceName, "Fail")
+	if _, err := fail.Call(context.Background(), &testArgs{Name: "boom"}); err == nil || CodeOf(err) != CodeUnknown {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestMethodStubGo(t *testing.T) {
+	cli := newTestStubClient(t)
+	add := NewMethod[*testArgs, testReply](cli, testServiceName, "Add")
+	fail := NewMethod[*testArgs, testReply](cli, testServiceName, "Fail")
+
+	futures := make([]*Future[testReply], 10)
+	for i := range futures {
+		futures[i] = add.Go(context.Background(), &testArgs{A: i, B: i})
+	}
+	failed := fail.Go(context.Background(), &testArgs{Name: "boom"})
+
+	for i, f := range futures {
+		select {
+		case <-f.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("future %d not done", i)
+		}
+		reply, err := f.Wait()
+		if err != nil || reply.Sum != 2*i {
+			t.Fatalf("future %d = %+v, %v", i, reply, err)
+		}
+		// Wait 可以多次调用
+		if again, err := f.Wait(); err != nil || again != reply {
+			t.Fatalf("second Wait = %+v, %v", again, err)
+		}
+	}
+	if _, err := failed.Wait(); CodeOf(err) != CodeUnknown || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestMethodStubStream(t *testing.T) {
+	cli := newTestStubClient(t)
+	count := NewMethod[*testArgs, testReply](cli, testServiceName, "Count")
+
+	var got []int
+	for reply, err := range count.Stream(context.Background(), &testArgs{A: 5}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, reply.Sum)
+	}
+	if len(got) != 5 || got[4] != 4 {
+		t.Fatalf("got %v", got)
+	}
+
+	// 方法返回错误时，迭代器在所有返回值之后产生这个错误
+	var n int
+	var streamErr error
+	for _, err := range count.Stream(context.Background(), &testArgs{A: 2, Name: "boom"}) {
+		if err != nil {
+			streamErr = err
+			continue
+		}
+		n++
+	}
+	if n != 2 || streamErr == nil || streamErr.Error() != "boom" {
+		t.Fatalf("n = %d, err = %v", n, streamErr)
+	}
+}
+
+// 提前退出迭代时关闭请求，服务端的 Send 随之失败
+func TestMethodStubStreamEarlyBreak(t *testing.T) {
+	cli := newTestStubClient(t)
+	count := NewMethod[*testArgs, testReply](cli, testServiceName, "Count")
+	select {
+	case <-testCountAborted:
+	default:
+	}
+
+	n := 0
+	for _, err := range count.Stream(context.Background(), &testArgs{A: -1}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	select {
+	case <-testCountAborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server stream was not closed after break")
+	}
+}
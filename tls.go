@@ -0,0 +1,161 @@
+package gorpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ServerTLSConfig 从文件加载服务端的 TLS 配置，也可以用于注册中心
+// 参数:
+//   - certFile: 服务端证书
+//   - keyFile: 服务端私钥
+//   - clientCAFile: 验证客户端证书的 CA，不为空时要求客户端提供证书（mTLS）
+//
+// 返回值:
+//   - *tls.Config: TLS 配置
+//   - error: 如果发生错误，则返回错误信息。
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// ClientTLSConfig 从文件加载客户端的 TLS 配置
+// 参数:
+//   - caFile: 验证服务端证书的 CA，为空时使用系统 CA
+//   - certFile: 客户端证书，服务端要求 mTLS 时需要，可以为空
+//   - keyFile: 客户端私钥
+//
+// 返回值:
+//   - *tls.Config: TLS 配置
+//   - error: 如果发生错误，则返回错误信息。
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
+
+// schemeOf 根据 TLS 配置返回 URL 的协议
+func schemeOf(config *tls.Config) string {
+	if config != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// baseURL 在没有协议的地址前加上协议
+// 注册中心返回的地址和用户传入的地址可能已经带有协议
+func baseURL(addr string, config *tls.Config) string {
+	if strings.Contains(addr, "://") {
+		return addr
+	}
+	return schemeOf(config) + "://" + addr
+}
+
+// Peer 调用方的信息
+type Peer struct {
+	Addr string               // 调用方的网络地址
+	TLS  *tls.ConnectionState // 连接的 TLS 状态，不使用 TLS 时为 nil
+	// 请求头，可以携带调用方自定义的元数据，gob 流中为升级请求的请求头
+	Header http.Header
+}
+
+// Identity 调用方经过验证的身份，即客户端证书的 Subject CommonName
+// 没有 CommonName 时依次使用证书中的第一个 URI 和 DNS 名字，没有经过验证的客户端证书时返回空字符串
+func (p *Peer) Identity() string {
+	cert := p.Certificate()
+	if cert == nil {
+		return ""
+	}
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// Certificate 调用方经过验证的客户端证书，没有时返回 nil
+func (p *Peer) Certificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.VerifiedChains) == 0 || len(p.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return p.TLS.VerifiedChains[0][0]
+}
+
+type peerKey struct{}
+
+// PeerFromContext 获取调用方的信息
+// 方法的第一个参数是 context.Context 时可以在方法中使用
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// peerContext 为请求创建带有调用方信息的上下文
+// 请求头中带有 traceparent 时，上下文中同时带有父 span
+// 上下文中总是带有请求 ID，请求头中没有时生成一个
+func peerContext(r *http.Request) context.Context {
+	ctx := context.WithValue(r.Context(), peerKey{}, &Peer{
+		Addr:   r.RemoteAddr,
+		TLS:    r.TLS,
+		Header: r.Header,
+	})
+	if sc := extractTrace(r.Header); sc.IsValid() {
+		ctx = ContextWithSpan(ctx, remoteSpan{sc})
+	}
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		ctx = WithRequestID(ctx, id)
+	}
+	return ensureRequestID(ctx)
+}
@@ -0,0 +1,217 @@
+package gorpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wifi32767/HTTPGoRpc/codec"
+)
+
+// testPKI 测试用的 CA 和由它签发的证书，都以 PEM 文件的形式保存在临时目录中
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gorpc test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testPKI{dir: t.TempDir(), ca: ca, caKey: key, serial: 1}
+	writePEM(t, p.path("ca.pem"), "CERTIFICATE", der)
+	return p
+}
+
+func (p *testPKI) path(name string) string {
+	return filepath.Join(p.dir, name)
+}
+
+// issue 签发一个证书，返回证书和私钥文件的路径
+// 服务端证书对 127.0.0.1 有效，客户端证书的 CommonName 为 name
+func (p *testPKI) issue(t *testing.T, name string, client bool) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if client {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		tmpl.IPAddresses = nil
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = p.path(name+".pem"), p.path(name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS 在新的端口上用 HTTPS 提供测试服务端的处理函数，返回地址
+func serveTLS(t *testing.T, config *tls.Config) string {
+	t.Helper()
+	startTestServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 握手失败是预期内的，不输出日志
+	srv := &http.Server{ErrorLog: log.New(io.Discard, "", 0)}
+	t.Cleanup(func() { srv.Close() })
+	go srv.Serve(tls.NewListener(ln, config))
+	return ln.Addr().String()
+}
+
+func whoami(t *testing.T, addr string, config *tls.Config) (string, error) {
+	t.Helper()
+	cli := NewClient(addr, &Options{CodecType: codec.TypeJson, TLSConfig: config, Logger: discardLogger()})
+	var reply testReply
+	err := cli.Call(context.Background(), testServiceName, "Whoami", &testArgs{}, &reply)
+	return reply.Name, err
+}
+
+func TestTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, serverKey := pki.issue(t, "server", false)
+	serverConfig, err := ServerTLSConfig(serverCert, serverKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConfig)
+
+	clientConfig, err := ClientTLSConfig(pki.path("ca.pem"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := whoami(t, addr, clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" {
+		t.Fatalf("identity without client certificate = %q", name)
+	}
+
+	// 不信任测试 CA 的客户端无法连接
+	if _, err := whoami(t, addr, &tls.Config{MinVersion: tls.VersionTLS12}); err == nil {
+		t.Fatal("call with untrusted server certificate should fail")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, serverKey := pki.issue(t, "server", false)
+	serverConfig, err := ServerTLSConfig(serverCert, serverKey, pki.path("ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTLS(t, serverConfig)
+
+	// 没有客户端证书时握手失败
+	noCert, err := ClientTLSConfig(pki.path("ca.pem"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := whoami(t, addr, noCert); err == nil {
+		t.Fatal("call without client certificate should fail")
+	}
+
+	// 由其他 CA 签发的客户端证书同样被拒绝
+	other := newTestPKI(t)
+	otherCert, otherKey := other.issue(t, "mallory", true)
+	untrusted, err := ClientTLSConfig(pki.path("ca.pem"), otherCert, otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := whoami(t, addr, untrusted); err == nil {
+		t.Fatal("call with untrusted client certificate should fail")
+	}
+
+	// 有效的客户端证书，身份通过 Peer 传给方法
+	clientCert, clientKey := pki.issue(t, "alice", true)
+	withCert, err := ClientTLSConfig(pki.path("ca.pem"), clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := whoami(t, addr, withCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "alice" {
+		t.Fatalf("identity = %q, want alice", name)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ClientTLSConfig(empty, "", ""); err == nil {
+		t.Error("ClientTLSConfig with invalid CA should fail")
+	}
+	if _, err := ClientTLSConfig(filepath.Join(dir, "missing.pem"), "", ""); err == nil {
+		t.Error("ClientTLSConfig with missing CA should fail")
+	}
+	if _, err := ServerTLSConfig(empty, empty, ""); err == nil {
+		t.Error("ServerTLSConfig with invalid certificate should fail")
+	}
+}
@@ -0,0 +1,309 @@
+package gorpc
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 链路追踪
+// 使用 W3C Trace Context 的 traceparent 和 tracestate 请求头在服务之间传递调用链
+// 客户端为每次调用开始一个 span 并把它写入请求头，服务端从请求头中取出父 span，在调用方法期间开始一个子 span
+// 通过 Tracer 接口可以接入 OpenTelemetry 等实现，也可以使用内置的 SimpleTracer
+
+// W3C Trace Context 的请求头
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// SpanContext 在服务之间传递的 span 信息
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte   // 最低位表示是否采样
+	TraceState string // 原样传递的 tracestate
+}
+
+// IsValid TraceID 和 SpanID 都不为0时有效
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Sampled 是否被采样
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&1 == 1
+}
+
+// TraceParent 格式化为 traceparent 请求头的值
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+// ParseTraceParent 解析 traceparent 请求头的值，格式不正确时返回 false
+// 更高版本的值只解析前四个字段
+func ParseTraceParent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, false
+	}
+	version := s[:2]
+	if version == "ff" || (version == "00" && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return sc, false
+	}
+	var v [1]byte
+	if !decodeLowerHex(v[:], version) ||
+		!decodeLowerHex(sc.TraceID[:], s[3:35]) ||
+		!decodeLowerHex(sc.SpanID[:], s[36:52]) ||
+		!decodeLowerHex(v[:], s[53:55]) {
+		return sc, false
+	}
+	sc.Flags = v[0]
+	return sc, sc.IsValid()
+}
+
+// decodeLowerHex 解码小写的十六进制字符串，规范不允许大写
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// injectTrace 把 span 信息写入请求头
+func injectTrace(h http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceParentHeader, sc.TraceParent())
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	}
+}
+
+// extractTrace 从请求头中取出 span 信息，没有或者格式不正确时返回无效的 SpanContext
+func extractTrace(h http.Header) SpanContext {
+	sc, ok := ParseTraceParent(strings.TrimSpace(h.Get(TraceParentHeader)))
+	if !ok {
+		return SpanContext{}
+	}
+	sc.TraceState = strings.Join(h.Values(TraceStateHeader), ",")
+	return sc
+}
+
+// SpanKind span 的类型
+type SpanKind int
+
+const (
+	SpanKindClient SpanKind = iota + 1 // 客户端发起的调用
+	SpanKindServer                     // 服务端处理的调用
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindClient:
+		return "client"
+	case SpanKindServer:
+		return "server"
+	}
+	return "unknown"
+}
+
+// Span 一次调用的追踪记录
+type Span interface {
+	// SpanContext 需要传递给下游的信息
+	SpanContext() SpanContext
+	// SetAttribute 设置属性
+	SetAttribute(key string, value any)
+	// End 结束 span，err 为调用的结果
+	End(err error)
+}
+
+// Tracer 创建 span，实现这个接口可以接入 OpenTelemetry 等追踪系统
+type Tracer interface {
+	// Start 开始一个 span
+	// parent 为父 span，可能来自其他服务，无效时开始一条新的调用链
+	Start(ctx context.Context, name string, kind SpanKind, parent SpanContext) Span
+}
+
+type spanKey struct{}
+
+// ContextWithSpan 返回带有 span 的上下文，之后用这个上下文发起的调用会成为它的子调用
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext 获取上下文中的 span
+// 方法的第一个参数是 context.Context 时，可以用它获取服务端为这次调用开始的 span
+func SpanFromContext(ctx context.Context) (Span, bool) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	return span, ok
+}
+
+// spanContextFrom 获取上下文中 span 的信息，没有时返回无效的 SpanContext
+func spanContextFrom(ctx context.Context) SpanContext {
+	if span, ok := SpanFromContext(ctx); ok {
+		return span.SpanContext()
+	}
+	return SpanContext{}
+}
+
+// remoteSpan 从请求头中取出的父 span，只用于传递，不记录任何信息
+// 服务端没有设置 Tracer 时，方法中发起的调用仍然属于同一条调用链
+type remoteSpan struct {
+	sc SpanContext
+}
+
+func (s remoteSpan) SpanContext() SpanContext { return s.sc }
+func (s remoteSpan) SetAttribute(string, any) {}
+func (s remoteSpan) End(error)                {}
+
+// startSpan 在 tracer 不为 nil 时开始一个父 span 在 ctx 中的 span
+// 返回的上下文带有新的 span，tracer 为 nil 时原样返回上下文和一个空的 span
+func startSpan(ctx context.Context, tracer Tracer, name string, kind SpanKind) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, remoteSpan{}
+	}
+	span := tracer.Start(ctx, name, kind, spanContextFrom(ctx))
+	return ContextWithSpan(ctx, span), span
+}
+
+// SpanData 结束的 span 的记录，由 SimpleTracer 交给 SpanExporter
+type SpanData struct {
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      SpanContext // 父 span，没有时无效
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]any
+	Code        Code   // 调用的结果
+	Error       string // 调用失败时的错误信息
+}
+
+// SpanExporter 处理结束的 span，需要保证线程安全
+type SpanExporter interface {
+	Export(span SpanData)
+}
+
+// SimpleTracer 内置的 Tracer，生成随机的 ID，把采样的 span 交给 Exporter
+// 没有父 span 时总是采样，否则沿用父 span 的采样标志
+type SimpleTracer struct {
+	Exporter SpanExporter
+}
+
+// NewSimpleTracer 创建内置的 Tracer
+func NewSimpleTracer(exporter SpanExporter) *SimpleTracer {
+	return &SimpleTracer{Exporter: exporter}
+}
+
+// Start 实现 Tracer 接口
+func (t *SimpleTracer) Start(ctx context.Context, name string, kind SpanKind, parent SpanContext) Span {
+	sc := SpanContext{Flags: 1}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		for sc.TraceID == [16]byte{} {
+			putRandom(sc.TraceID[:])
+		}
+	}
+	for sc.SpanID == [8]byte{} {
+		putRandom(sc.SpanID[:])
+	}
+	return &simpleSpan{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  make(map[string]any),
+		},
+	}
+}
+
+func putRandom(b []byte) {
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+}
+
+type simpleSpan struct {
+	tracer *SimpleTracer
+	mutex  sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *simpleSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *simpleSpan) SetAttribute(key string, value any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.data.Attributes[key] = value
+	}
+}
+
+// End 只有第一次调用生效
+func (s *simpleSpan) End(err error) {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.Code = CodeOf(err)
+	if err != nil {
+		s.data.Error = err.Error()
+	}
+	data := s.data
+	s.mutex.Unlock()
+	if data.SpanContext.Sampled() && s.tracer.Exporter != nil {
+		s.tracer.Exporter.Export(data)
+	}
+}
+
+// InMemoryExporter 把 span 保存在内存中，用于测试和调试
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter 创建内存中的 SpanExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// Export 实现 SpanExporter 接口
+func (e *InMemoryExporter) Export(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans 按结束顺序返回所有的 span
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset 清空保存的 span
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,153 @@
+package gorpc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ok   bool
+	}{
+		{"valid", testTraceParent, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		// 更高版本只解析前四个字段
+		{"future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"empty", "", false},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"version 00 with extra", testTraceParent + "-extra", false},
+		{"bad separator", "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false},
+		{"short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceParent(tt.in)
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceParent(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			}
+			if ok && tt.name == "valid" && sc.TraceParent() != tt.in {
+				t.Fatalf("TraceParent() = %q", sc.TraceParent())
+			}
+		})
+	}
+}
+
+// withTracer 在测试期间为共用的服务端设置 Tracer，返回记录服务端 span 的 exporter
+func withTracer(t *testing.T, s *Server) *InMemoryExporter {
+	t.Helper()
+	exporter := NewInMemoryExporter()
+	old := s.Tracer
+	s.Tracer = NewSimpleTracer(exporter)
+	t.Cleanup(func() { s.Tracer = old })
+	return exporter
+}
+
+// onlySpan 返回 exporter 中唯一的 span
+func onlySpan(t *testing.T, exporter *InMemoryExporter) SpanData {
+	t.Helper()
+	spans := exporter.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	return spans[0]
+}
+
+func TestTraceClientToServer(t *testing.T) {
+	s, addr := startTestServer(t)
+	serverSpans := withTracer(t, s)
+	clientSpans := NewInMemoryExporter()
+	cli := NewClient(addr, &Options{Tracer: NewSimpleTracer(clientSpans), Logger: discardLogger()})
+
+	if err := cli.Call(context.Background(), testServiceName, "Add", &testArgs{A: 1}, &testReply{}); err != nil {
+		t.Fatal(err)
+	}
+	client := onlySpan(t, clientSpans)
+	server := onlySpan(t, serverSpans)
+	if client.Kind != SpanKindClient || server.Kind != SpanKindServer {
+		t.Fatalf("kinds = %v, %v", client.Kind, server.Kind)
+	}
+	if client.Parent.IsValid() {
+		t.Fatalf("client span should be a root span, parent %s", client.Parent.TraceParent())
+	}
+	// 服务端 span 的父 span 就是客户端 span，二者属于同一条调用链
+	if server.Parent.TraceID != client.SpanContext.TraceID || server.Parent.SpanID != client.SpanContext.SpanID {
+		t.Fatalf("server parent %s, client span %s", server.Parent.TraceParent(), client.SpanContext.TraceParent())
+	}
+	if server.SpanContext.TraceID != client.SpanContext.TraceID || server.SpanContext.SpanID == client.SpanContext.SpanID {
+		t.Fatalf("server span %s, client span %s", server.SpanContext.TraceParent(), client.SpanContext.TraceParent())
+	}
+	if server.Name != testServiceName+"/Add" || server.Attributes["rpc.method"] != "Add" {
+		t.Fatalf("server span = %+v", server)
+	}
+
+	// 失败的调用记录错误码
+	clientSpans.Reset()
+	serverSpans.Reset()
+	_ = cli.Call(context.Background(), testServiceName, "Fail", &testArgs{Name: "boom"}, &testReply{})
+	if server := onlySpan(t, serverSpans); server.Code != CodeUnknown || server.Error != "boom" {
+		t.Fatalf("failed server span: code %s, error %q", server.Code, server.Error)
+	}
+	if client := onlySpan(t, clientSpans); client.Code != CodeUnknown {
+		t.Fatalf("failed client span: code %s", client.Code)
+	}
+}
+
+// 请求头中的 traceparent 无效时服务端开始一条新的调用链
+func TestTraceParentFromHeader(t *testing.T) {
+	s, addr := startTestServer(t)
+	exporter := withTracer(t, s)
+	want, _ := ParseTraceParent(testTraceParent)
+	tests := []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		valid       bool
+	}{
+		{"valid", testTraceParent, "vendor=a", true},
+		{"malformed", "00-xyz", "", false},
+		{"all zero", "00-00000000000000000000000000000000-0000000000000000-01", "", false},
+		{"uppercase", strings.ToUpper(testTraceParent), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			header := http.Header{TraceParentHeader: {tt.traceparent}}
+			if tt.tracestate != "" {
+				header.Set(TraceStateHeader, tt.tracestate)
+			}
+			resp := postCall(t, addr, "Add", header, strings.NewReader(`{"A":1}`))
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d", resp.StatusCode)
+			}
+			span := onlySpan(t, exporter)
+			if !span.SpanContext.IsValid() || !span.SpanContext.Sampled() {
+				t.Fatalf("server span %s", span.SpanContext.TraceParent())
+			}
+			if !tt.valid {
+				if span.Parent.IsValid() {
+					t.Fatalf("parent should be invalid, got %s", span.Parent.TraceParent())
+				}
+				if span.SpanContext.TraceID == want.TraceID {
+					t.Fatal("new root trace reused the trace ID")
+				}
+				return
+			}
+			if span.Parent.TraceID != want.TraceID || span.Parent.SpanID != want.SpanID {
+				t.Fatalf("parent = %s", span.Parent.TraceParent())
+			}
+			if span.SpanContext.TraceID != want.TraceID || span.SpanContext.TraceState != tt.tracestate {
+				t.Fatalf("span = %s %q", span.SpanContext.TraceParent(), span.SpanContext.TraceState)
+			}
+		})
+	}
+}